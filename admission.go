@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+const (
+	memoryBudgetEnv = "MEMORY_BUDGET_MB"
+	workersEnv      = "WORKERS"
+	bytesPerMB      = 1 << 20
+)
+
+// Rough per-record memory costs of a run, in bytes
+const (
+	// record with both tree views, its members map entry and its idLookupTable entry with the Salesforce ID
+	recordBytes = 560
+	// a tree's Members map entry, children slice and lineage chain
+	treeBytes = 120
+	// transient allocations while a single tree is calculated
+	calculationBytes = 64
+	// ultimate parent and ancestor path of a tree
+	ancestryBytes = 160
+	// a single level ancestor of a tree and its Salesforce ID
+	levelAncestorBytes = 40
+	// a single generation count of a tree
+	generationBytes = 4
+	// a frozen copy of a tree held for snapshots, diffs and comparisons
+	snapshotBytes = 140
+	// query rows waiting to be digested, capped by the batch size and channel depth
+	queryRowBytes = 200
+	queryBatches  = 6
+	// idLookupTable entry with the Salesforce ID, all a low memory run keeps of a record
+	lookupBytes = 96
+	// a changed tree held for the update by a low memory run
+	updateBytes = 120
+)
+
+// admission is how a job is let in given its memory estimate
+type admission string
+
+const (
+	// admitRun runs the job straight away
+	admitRun admission = "run"
+	// admitQueued runs the job once running jobs released enough memory
+	admitQueued admission = "queued"
+	// admitLowMemory runs the job with the low memory strategy because the requested settings don't fit the budget
+	admitLowMemory admission = "lowMemory"
+	// admitRejected doesn't run the job, it can't fit the budget even on its own
+	admitRejected admission = "rejected"
+)
+
+// estimateMemory estimates the peak bytes a run needs for the record count and job settings
+func estimateMemory(records uint64, opts jobOptions) uint64 {
+	trees := uint64(len(parentModes))
+	queryRows := records
+	if limit := uint64(retrieveRecordCount * queryBatches); queryRows > limit {
+		queryRows = limit
+	}
+	if opts.lowMemory {
+		// The records are spilled to disk and every changed tree may be held for the update
+		return records*(lookupBytes+trees*updateBytes) + uint64(engine.DefaultExternalMemoryLimit) +
+			queryRows*queryRowBytes
+	}
+	perTree := uint64(treeBytes)
+	if opts.Ancestry {
+		perTree += ancestryBytes
+	}
+	perTree += uint64(opts.LevelAncestors) * levelAncestorBytes
+	perTree += uint64(opts.GenerationLevels) * generationBytes
+	if opts.SaveSnapshots || opts.DiffPrevious || opts.CompareHierarchies {
+		perTree += snapshotBytes
+	}
+	return records*(recordBytes+trees*(perTree+calculationBytes)) + queryRows*queryRowBytes
+}
+
+// lowMemoryUnsupported lists the requested options the low memory strategy can't run. It only streams the trees
+// through engine.CalculateExternal and updates the lineage chains and depths, so a job asking for anything else
+// is rejected rather than run without it. engine.CalculateExternal always hands out new codes in ID order, a job
+// must ask for that with siblingIdOrder so it gets the same codes whichever way it's admitted.
+func lowMemoryUnsupported(opts jobOptions) []string {
+	var unsupported []string
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"siblingIdOrder=false", !opts.SiblingIDOrder},
+		{"generationLevels", opts.GenerationLevels > 0},
+		{"rollupValueField", opts.RollupValueField != ""},
+		{"ancestry", opts.Ancestry},
+		{"levelAncestors", opts.LevelAncestors > 0},
+		{"closureTable", opts.ClosureTable},
+		{"restoreParents", opts.RestoreParents},
+		{"compareHierarchies", opts.CompareHierarchies},
+		{"saveSnapshots", opts.SaveSnapshots},
+		{"diffPrevious", opts.DiffPrevious},
+		{"traceIds", len(opts.TraceIDs) > 0},
+		{"asOfDates", len(opts.AsOfDates) > 0 || opts.MonthEndsFrom != "" || opts.MonthEndsTo != ""},
+		{"exportChanges", opts.ExportChanges},
+		{"alphabetField", opts.AlphabetField != ""},
+		{"validateChains", opts.ValidateChains},
+	} {
+		if o.set {
+			unsupported = append(unsupported, o.name)
+		}
+	}
+	return unsupported
+}
+
+// memoryBudget admits jobs while the sum of their estimates stays within the limit, a limit of 0 admits everything
+type memoryBudget struct {
+	mu       sync.Mutex
+	released *sync.Cond
+	limit    uint64
+	reserved uint64
+}
+
+func newMemoryBudget(limit uint64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.released = sync.NewCond(&b.mu)
+	return b
+}
+
+// admit reserves memory for a job, switching to the low memory strategy when allowed, needed and able to run the
+// requested options, and waiting for running jobs when the job only fits once they're done. Unless the job is
+// rejected, release must be called once it's finished.
+func (b *memoryBudget) admit(records uint64, opts *jobOptions) (decision admission, estimate uint64, release func()) {
+	decision = admitRun
+	estimate = estimateMemory(records, *opts)
+	if b.limit > 0 && estimate > b.limit {
+		low := *opts
+		low.lowMemory = true
+		lowEstimate := estimateMemory(records, low)
+		if !opts.AllowLowMemory || len(lowMemoryUnsupported(low)) > 0 || lowEstimate > b.limit {
+			return admitRejected, estimate, nil
+		}
+		*opts = low
+		decision, estimate = admitLowMemory, lowEstimate
+	}
+
+	b.mu.Lock()
+	for b.limit > 0 && b.reserved+estimate > b.limit {
+		if decision == admitRun {
+			decision = admitQueued
+		}
+		b.released.Wait()
+	}
+	b.reserved += estimate
+	b.mu.Unlock()
+	return decision, estimate, func() {
+		b.mu.Lock()
+		b.reserved -= estimate
+		b.mu.Unlock()
+		b.released.Broadcast()
+	}
+}
+
+// envUint reads a whole number setting from the environment, falling back to the default when unset or invalid
+func envUint(name string, fallback uint64) uint64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		fmt.Printf("Ignoring invalid %s %q\n", name, v)
+		return fallback
+	}
+	return n
+}
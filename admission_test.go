@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdmitQueuedUntilReleased(t *testing.T) {
+	opts := jobOptions{}
+	b := newMemoryBudget(estimateMemory(1000, opts))
+
+	decision, _, release := b.admit(1000, &opts)
+	if decision != admitRun {
+		t.Fatalf("Expected the first job to run, instead held %s", decision)
+	}
+	admitted := make(chan admission)
+	go func() {
+		second := jobOptions{}
+		decision, _, release := b.admit(1000, &second)
+		release()
+		admitted <- decision
+	}()
+	select {
+	case decision := <-admitted:
+		t.Fatalf("Expected the second job to wait, instead held %s", decision)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case decision := <-admitted:
+		if decision != admitQueued {
+			t.Errorf("Expected the second job to be queued, instead held %s", decision)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second job to run once the first released its memory")
+	}
+	if b.reserved != 0 {
+		t.Errorf("Expected all memory released, instead held %d", b.reserved)
+	}
+}
+
+func TestAdmitLowMemory(t *testing.T) {
+	const records = 10000000
+	low := jobOptions{lowMemory: true}
+	limit := estimateMemory(records, low)
+	if limit >= estimateMemory(records, jobOptions{}) {
+		t.Fatalf("Expected the low memory strategy to need less memory")
+	}
+	tests := []struct {
+		name     string
+		opts     jobOptions
+		expected admission
+	}{
+		{"not allowed", jobOptions{}, admitRejected},
+		{"allowed", jobOptions{AllowLowMemory: true, SiblingIDOrder: true}, admitLowMemory},
+		{"unsupported option", jobOptions{AllowLowMemory: true, SiblingIDOrder: true, SaveSnapshots: true},
+			admitRejected},
+		{"unordered siblings", jobOptions{AllowLowMemory: true}, admitRejected},
+	}
+	for _, test := range tests {
+		b := newMemoryBudget(limit)
+		opts := test.opts
+		decision, _, release := b.admit(records, &opts)
+		if decision != test.expected {
+			t.Errorf("%s: expected %s, instead held %s", test.name, test.expected, decision)
+		}
+		if opts.lowMemory != (decision == admitLowMemory) {
+			t.Errorf("%s: expected the low memory strategy only when admitted with it", test.name)
+		}
+		if release != nil {
+			release()
+		}
+	}
+	unsupported := lowMemoryUnsupported(jobOptions{SiblingIDOrder: true, SaveSnapshots: true, Ancestry: true})
+	if len(unsupported) != 2 || unsupported[0] != "ancestry" || unsupported[1] != "saveSnapshots" {
+		t.Errorf("Expected ancestry and saveSnapshots to be unsupported, instead held %v", unsupported)
+	}
+}
+
+func TestValidateNegativeOptions(t *testing.T) {
+	for _, opts := range []jobOptions{
+		{GenerationLevels: -1},
+		{RollupLevels: -1},
+		{LevelAncestors: -1},
+		{ClosureMaxDistance: -1},
+		{ChainMaxLength: -1},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", opts)
+		}
+	}
+	if err := (jobOptions{LevelAncestors: 3}).validate(); err != nil {
+		t.Errorf("Expected valid options to pass, instead held %v", err)
+	}
+}
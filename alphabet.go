@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	_ "embed" // embeds the bundled alphabet
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+// Columns of the alphabet CSV
+const (
+	alphabetCharColumn  = "unicode_character__c"
+	alphabetIndexColumn = "unicode_index__c"
+	alphabetOrderColumn = "order__c"
+)
+
+// defaultAlphabetProfile is the profile used when a job doesn't choose one, every loaded character
+const defaultAlphabetProfile = "default"
+
+//go:embed assets/unicodechars.csv
+var embeddedChars []byte
+
+// alphabetProfiles derive the named alphabets a job can choose from the loaded characters, keeping their order
+var alphabetProfiles = map[string]func([]string) []string{
+	defaultAlphabetProfile: func(chars []string) []string { return chars },
+	// bmp-safe is every character of the Basic Multilingual Plane the alphabet linter finds no issues with
+	"bmp-safe": func(chars []string) []string {
+		return engine.SafeChars(filterChars(chars, func(r rune) bool { return r <= 0xFFFF }))
+	},
+	// ascii is the printable ASCII characters, for fields and integrations that only handle ASCII
+	"ascii": func(chars []string) []string {
+		return filterChars(chars, func(r rune) bool { return r > ' ' && r <= '~' })
+	},
+	// alphanumeric is the ASCII letters and digits
+	"alphanumeric": func(chars []string) []string {
+		return filterChars(chars, func(r rune) bool {
+			return r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		})
+	},
+	// utf8mb3 is the characters encoding to at most 3 bytes, for MySQL utf8 (utf8mb3) columns chains are copied to.
+	// The bundled CSV only holds Basic Multilingual Plane characters, up to U+D6D7, so it currently matches the
+	// default profile. Jobs choosing it keep their chains within 3 bytes should the CSV grow past the BMP.
+	"utf8mb3": func(chars []string) []string {
+		return filterChars(chars, func(r rune) bool { return utf8.RuneLen(r) <= 3 })
+	},
+	// case-insensitive is one character of each case folding class, for orgs queried with case-insensitive LIKE
+	"case-insensitive": engine.CaseInsensitiveChars,
+}
+
+// alphabetProfileNames lists the profiles in name order
+func alphabetProfileNames() []string {
+	names := make([]string, 0, len(alphabetProfiles))
+	for name := range alphabetProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// alphabetProfile looks up the named profile, the default profile when the name is empty
+func alphabetProfile(name string) (func([]string) []string, error) {
+	if name == "" {
+		name = defaultAlphabetProfile
+	}
+	profile, ok := alphabetProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown alphabet profile %q, choose one of %s", name,
+			strings.Join(alphabetProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// profileChars builds the named profile from the loaded characters
+func profileChars(name string, loaded []string) ([]string, error) {
+	profile, err := alphabetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile(loaded), nil
+}
+
+// filterChars keeps the characters whose rune passes keep, in their original order
+func filterChars(chars []string, keep func(rune) bool) []string {
+	kept := make([]string, 0, len(chars))
+	for _, c := range chars {
+		if r, _ := utf8.DecodeRuneInString(c); keep(r) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Load characters from the embedded CSV to behave like a multi-thousand based number system
+func loadChars() []string {
+	c, err := readAlphabetCSV(bytes.NewReader(embeddedChars))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// loadCharsFile loads the characters of an alphabet CSV, dropping the outlawed ones
+func loadCharsFile(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	c, err := readAlphabetCSV(f)
+	if err != nil {
+		panic(fmt.Errorf("reading %s: %v", path, err))
+	}
+	return c
+}
+
+// readAlphabetCSV reads the characters of an alphabet CSV sorted by order__c, rows without an order keep their place
+// after the ordered rows. unicode_index__c is the code point of the character and wins over the character column,
+// which spreadsheet tools tend to trim or mangle, surrogate halves aren't characters and are refused. Outlawed
+// characters are dropped.
+func readAlphabetCSV(r io.Reader) ([]string, error) {
+	lines, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("alphabet CSV is empty")
+	}
+	columns := make(map[string]int)
+	for i, name := range lines[0] {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF"))] = i
+	}
+	charColumn, ok := columns[alphabetCharColumn]
+	if !ok {
+		return nil, fmt.Errorf("alphabet CSV has no %s column", alphabetCharColumn)
+	}
+	indexColumn, hasIndex := columns[alphabetIndexColumn]
+	orderColumn, hasOrder := columns[alphabetOrderColumn]
+
+	type entry struct {
+		char    string
+		order   float64
+		ordered bool
+	}
+	entries := make([]entry, 0, len(lines)-1)
+	for n, line := range lines[1:] {
+		e := entry{char: line[charColumn]}
+		if hasIndex && line[indexColumn] != "" {
+			index, err := strconv.ParseFloat(line[indexColumn], 64)
+			if err != nil || index < 0 || index > utf8.MaxRune || index != float64(int64(index)) ||
+				!utf8.ValidRune(rune(index)) {
+				return nil, fmt.Errorf("invalid %s %q on line %d", alphabetIndexColumn, line[indexColumn], n+2)
+			}
+			e.char = string(rune(index))
+		}
+		if hasOrder && line[orderColumn] != "" {
+			if e.order, err = strconv.ParseFloat(line[orderColumn], 64); err != nil {
+				return nil, fmt.Errorf("invalid %s %q on line %d", alphabetOrderColumn, line[orderColumn], n+2)
+			}
+			e.ordered = true
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ordered != entries[j].ordered {
+			return entries[i].ordered
+		}
+		return entries[i].ordered && entries[i].order < entries[j].order
+	})
+
+	invalidCharMap := make(map[string]bool)
+	for _, c := range invalidChars {
+		invalidCharMap[c] = true
+	}
+	mChars := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if _, invalid := invalidCharMap[e.char]; invalid {
+			// Skip the char because we've outlawed it
+			continue
+		}
+		mChars = append(mChars, e.char)
+	}
+	return mChars, nil
+}
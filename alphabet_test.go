@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+func TestReadAlphabetCSV(t *testing.T) {
+	csv := "\uFEFFunicode_character__c,unicode_index__c,order__c\n" +
+		"c,,2\n" +
+		"u,,\n" +
+		"a,,0.5\n" +
+		"?,98,1\n" + // the index wins over a mangled character
+		"%,,3\n" + // outlawed
+		"v,,\n"
+	chars, err := readAlphabetCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(chars, "") != "abcuv" {
+		t.Errorf("Expected ordered rows then unordered rows, instead held %q", chars)
+	}
+
+	for name, csv := range map[string]string{
+		"surrogate index":  "unicode_character__c,unicode_index__c\na,55296\n",
+		"negative index":   "unicode_character__c,unicode_index__c\na,-1\n",
+		"fractional index": "unicode_character__c,unicode_index__c\na,97.5\n",
+		"invalid order":    "unicode_character__c,order__c\na,first\n",
+		"no char column":   "unicode_index__c\n97\n",
+		"empty":            "",
+	} {
+		if _, err := readAlphabetCSV(strings.NewReader(csv)); err == nil {
+			t.Errorf("Expected the %s to be rejected", name)
+		}
+	}
+}
+
+func TestEmbeddedAlphabet(t *testing.T) {
+	// Reordering the bundled characters reassigns every org's chains, this pins them
+	loaded := loadChars()
+	if len(loaded) != 51743 || engine.AlphabetFingerprint(loaded) != "fdfa445fb60be5d6" {
+		t.Errorf("Expected the bundled alphabet to hold 51743 characters with fingerprint fdfa445fb60be5d6, "+
+			"instead held %d with %s", len(loaded), engine.AlphabetFingerprint(loaded))
+	}
+}
+
+func TestProfileChars(t *testing.T) {
+	loaded := []string{"a", "B", "1", "~", " ", "é", "а", "A", "\U0001F600"}
+	expected := map[string]string{
+		"":                 "aB1~ éаA\U0001F600",
+		"default":          "aB1~ éаA\U0001F600",
+		"ascii":            "aB1~A",
+		"alphanumeric":     "aB1A",
+		"utf8mb3":          "aB1~ éаA",
+		"bmp-safe":         "aB1~éA",
+		"case-insensitive": "aB1~ éа\U0001F600",
+	}
+	for name, chars := range expected {
+		profile, err := profileChars(name, loaded)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Join(profile, "") != chars {
+			t.Errorf("Expected profile %q to hold %q, instead held %q", name, chars, strings.Join(profile, ""))
+		}
+	}
+	if len(expected)-1 != len(alphabetProfiles) {
+		t.Errorf("Expected every profile to be covered, instead held %v", alphabetProfileNames())
+	}
+	if _, err := profileChars("unknown", loaded); err == nil {
+		t.Errorf("Expected an unknown profile to be rejected")
+	}
+}
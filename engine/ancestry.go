@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// AncestorPathTruncated marks the start of an ancestor path that dropped its top-most ancestors to fit
+const AncestorPathTruncated = "…"
+
+// AncestryRecord is an optional Record extension that receives the top-most ancestor and the ancestor path
+type AncestryRecord interface {
+	SetRootID(uint32)
+	SetAncestors([]uint32)
+}
+
+// LevelAncestorRecord is an optional Record extension that receives a fixed number of ancestors for flattened
+// Level_N columns
+type LevelAncestorRecord interface {
+	SetLevelAncestors([]uint32)
+}
+
+// LevelOrder selects which ancestors fill the Level_N columns
+type LevelOrder int
+
+const (
+	// LevelsFromRoot fills Level_1 with the root and continues down toward the record
+	LevelsFromRoot LevelOrder = iota
+	// LevelsFromRecord fills Level_1 with the direct parent and continues up toward the root
+	LevelsFromRecord
+)
+
+// CalculateAncestry hands every record implementing AncestryRecord the ID of its top-most ancestor and the IDs of all
+// of its ancestors ordered from the root down to the direct parent. A root record is its own root with no ancestors.
+// Children must already be linked by CalculateHierarchy.
+// Siblings share the same ancestor slice, it must be treated as read only.
+func (group *Group) CalculateAncestry() {
+	group.walkAncestry(func(r Record, rootID uint32, ancestors []uint32) bool {
+		ar, ok := r.(AncestryRecord)
+		if ok {
+			ar.SetRootID(rootID)
+			ar.SetAncestors(ancestors)
+		}
+		return ok
+	})
+}
+
+// CalculateLevelAncestors hands every record implementing LevelAncestorRecord up to levels ancestors, either the
+// first ones from the root down or the nearest ones from the record up. Records with fewer ancestors receive a
+// shorter list. Children must already be linked by CalculateHierarchy. A negative number of levels is treated as 0.
+func (group *Group) CalculateLevelAncestors(levels int, order LevelOrder) {
+	if levels < 0 {
+		levels = 0
+	}
+	group.walkAncestry(func(r Record, rootID uint32, ancestors []uint32) bool {
+		lr, ok := r.(LevelAncestorRecord)
+		if !ok {
+			return false
+		}
+		count := len(ancestors)
+		if count > levels {
+			count = levels
+		}
+		switch order {
+		case LevelsFromRoot:
+			lr.SetLevelAncestors(ancestors[:count:count])
+		case LevelsFromRecord:
+			nearest := make([]uint32, count)
+			for i := range nearest {
+				nearest[i] = ancestors[len(ancestors)-1-i]
+			}
+			lr.SetLevelAncestors(nearest)
+		}
+		return true
+	})
+}
+
+// walkAncestry visits every record reachable from a root with the root's ID and the record's ancestors ordered from
+// the root down, the visitor reports whether it changed the record so it can be stored back
+func (group *Group) walkAncestry(visit func(r Record, rootID uint32, ancestors []uint32) bool) {
+	for _, v := range group.Members {
+		if _, ok := group.Members[v.GetParentID()]; ok {
+			continue
+		}
+		group.walkAncestryFrom(v.GetID(), v.GetID(), []uint32{}, visit)
+	}
+}
+
+func (group *Group) walkAncestryFrom(id uint32, rootID uint32, ancestors []uint32, visit func(Record, uint32, []uint32) bool) {
+	r := group.Members[id]
+	if visit(r, rootID, ancestors) {
+		group.Members[id] = r
+	}
+	if len(r.GetChildren()) == 0 {
+		return
+	}
+	// Cap the capacity so appending always copies rather than writing into a slice shared with siblings
+	childAncestors := append(ancestors[:len(ancestors):len(ancestors)], id)
+	for _, cID := range r.GetChildren() {
+		group.walkAncestryFrom(cID, rootID, childAncestors, visit)
+	}
+}
+
+// JoinAncestorPath joins an ancestor path ordered from the root down, dropping ancestors from the root end until it
+// fits maxLength characters. A shortened path starts with AncestorPathTruncated, a maxLength of 0 or less keeps the
+// whole path. Reports whether the path was shortened.
+func JoinAncestorPath(ancestors []string, separator string, maxLength int) (string, bool) {
+	path := strings.Join(ancestors, separator)
+	if maxLength <= 0 || utf8.RuneCountInString(path) <= maxLength {
+		return path, false
+	}
+	// Keep the nearest ancestors, the root end is in the ultimate parent field anyway
+	length := utf8.RuneCountInString(AncestorPathTruncated)
+	first := len(ancestors)
+	for first > 0 {
+		next := length + utf8.RuneCountInString(separator) + utf8.RuneCountInString(ancestors[first-1])
+		if next > maxLength {
+			break
+		}
+		length = next
+		first--
+	}
+	return strings.Join(append([]string{AncestorPathTruncated}, ancestors[first:]...), separator), true
+}
@@ -0,0 +1,95 @@
+package engine
+
+import "testing"
+
+func TestCalculateAncestry(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{4, 2, "", ""},
+		{5, 4, "", ""},
+		{6, Uint32Max, "", ""},
+	}
+
+	data := verifyHierarchy(t, dataTable)
+	data.CalculateAncestry()
+
+	expected := map[uint32][]uint32{
+		1: {},
+		2: {1},
+		3: {1},
+		4: {1, 2},
+		5: {1, 2, 4},
+		6: {},
+	}
+	for id, ancestors := range expected {
+		r := data.Members[id].(*record)
+		assertUint32s(t, ancestors, r.ancestors)
+		rootID := id
+		if len(ancestors) > 0 {
+			rootID = ancestors[0]
+		}
+		if r.rootID != rootID {
+			t.Errorf("Expected %v to have root %v, instead held %v", id, rootID, r.rootID)
+		}
+	}
+}
+
+func TestCalculateLevelAncestors(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 2, "", ""},
+		{4, 3, "", ""},
+		{5, 4, "", ""},
+	}
+
+	data := verifyHierarchy(t, dataTable)
+	data.CalculateLevelAncestors(3, LevelsFromRoot)
+	assertUint32s(t, []uint32{1, 2, 3}, data.Members[5].(*record).levelAncestors)
+	assertUint32s(t, []uint32{1}, data.Members[2].(*record).levelAncestors)
+	assertUint32s(t, []uint32{}, data.Members[1].(*record).levelAncestors)
+
+	data.CalculateLevelAncestors(3, LevelsFromRecord)
+	assertUint32s(t, []uint32{4, 3, 2}, data.Members[5].(*record).levelAncestors)
+	assertUint32s(t, []uint32{2, 1}, data.Members[3].(*record).levelAncestors)
+
+	// Negative levels hand out no ancestors
+	for _, order := range []LevelOrder{LevelsFromRoot, LevelsFromRecord} {
+		data.CalculateLevelAncestors(-1, order)
+		assertUint32s(t, []uint32{}, data.Members[5].(*record).levelAncestors)
+	}
+}
+
+func TestJoinAncestorPath(t *testing.T) {
+	ancestors := []string{"1000", "2000", "3000", "4000"}
+	tests := []struct {
+		maxLength int
+		path      string
+		truncated bool
+	}{
+		{0, "1000/2000/3000/4000", false},
+		// Exactly at the limit
+		{19, "1000/2000/3000/4000", false},
+		{18, "…/2000/3000/4000", true},
+		{16, "…/2000/3000/4000", true},
+		{15, "…/3000/4000", true},
+		{5, "…", true},
+	}
+	for _, tt := range tests {
+		path, truncated := JoinAncestorPath(ancestors, "/", tt.maxLength)
+		if path != tt.path || truncated != tt.truncated {
+			t.Errorf("Expected %q (%v) at %d, instead held %q (%v)", tt.path, tt.truncated, tt.maxLength, path, truncated)
+		}
+		if tt.maxLength > 0 && len([]rune(path)) > tt.maxLength {
+			t.Errorf("Expected %q to fit %d characters", path, tt.maxLength)
+		}
+	}
+}
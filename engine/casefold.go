@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CheckCaseFold flags chains that equal another record's chain once case is ignored, a case-insensitive LIKE on
+// either of them also matches the other's downline
+const CheckCaseFold = "case_fold"
+
+// ValidationIssue is a record whose chain fails a validation check, ConflictID is a record it conflicts with
+type ValidationIssue struct {
+	ID         uint32
+	BranchID   string
+	Check      string
+	ConflictID uint32
+}
+
+// foldRune maps a rune to the smallest rune it's equal to under simple case folding, so every case variant of a
+// character shares the same key
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+// foldChain maps every character of a chain to its case folding key
+func foldChain(chain string) string {
+	folded := make([]rune, 0, utf8.RuneCountInString(chain))
+	for _, r := range chain {
+		folded = append(folded, foldRune(r))
+	}
+	return string(folded)
+}
+
+// CaseInsensitiveChars removes the characters that equal an earlier character under case folding, across all of
+// Unicode rather than just ASCII, so no two chains built from the result differ by case alone
+func CaseInsensitiveChars(chars []string) []string {
+	seen := make(map[rune]void, len(chars))
+	kept := make([]string, 0, len(chars))
+	for _, c := range chars {
+		r, _ := utf8.DecodeRuneInString(c)
+		key := foldRune(r)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = emptyVal
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// Validate checks the chains the records currently hold, returning an issue per failing record ordered by ID
+func (group *Group) Validate() []ValidationIssue {
+	// The first record seen with each exact chain, by the chain's case folding key
+	type holder struct {
+		id       uint32
+		branchID string
+	}
+	byFold := make(map[string][]holder)
+	ids := group.sortedIDs()
+	for _, id := range ids {
+		branchID := group.Members[id].GetBranchID()
+		if branchID == "" {
+			continue
+		}
+		key := foldChain(branchID)
+		known := false
+		for _, h := range byFold[key] {
+			if h.branchID == branchID {
+				known = true
+				break
+			}
+		}
+		if !known {
+			byFold[key] = append(byFold[key], holder{id, branchID})
+		}
+	}
+
+	var issues []ValidationIssue
+	for _, id := range ids {
+		branchID := group.Members[id].GetBranchID()
+		if branchID == "" {
+			continue
+		}
+		for _, h := range byFold[foldChain(branchID)] {
+			if h.branchID != branchID {
+				issues = append(issues, ValidationIssue{ID: id, BranchID: branchID, Check: CheckCaseFold, ConflictID: h.id})
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// WriteValidationCSV writes validation issues as CSV rows
+func WriteValidationCSV(w io.Writer, issues []ValidationIssue) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "branch_id", "check", "conflict_id"}); err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		err := cw.Write([]string{
+			strconv.FormatUint(uint64(issue.ID), 10),
+			issue.BranchID,
+			issue.Check,
+			strconv.FormatUint(uint64(issue.ConflictID), 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCaseInsensitiveChars(t *testing.T) {
+	folded := CaseInsensitiveChars(chars)
+	if len(folded) != 37 {
+		t.Errorf("Expected the upper case letters to be removed, instead held %d characters", len(folded))
+	}
+	for i, c := range folded[:26] {
+		verifyBranchID(t, chars[i], c)
+	}
+	verifyBranchID(t, "늌", folded[len(folded)-1])
+
+	// The Kelvin sign and long s fold to k and s, the Greek sigmas all fold together
+	folded = CaseInsensitiveChars([]string{"k", "K", "ſ", "S", "σ", "ς", "Σ", "é", "É"})
+	expected := []string{"k", "ſ", "σ", "é"}
+	if len(folded) != len(expected) {
+		t.Fatalf("Expected %q, instead held %q", expected, folded)
+	}
+	for i := range expected {
+		verifyBranchID(t, expected[i], folded[i])
+	}
+}
+
+func TestValidateCaseFold(t *testing.T) {
+	data := Group{Members: make(map[uint32]Record)}
+	data.SetChars(chars)
+	for id, branchID := range map[uint32]string{1: "a", 2: "A", 3: "ab", 4: "b", 5: "", 6: "aB", 7: "ab"} {
+		data.Members[id] = &record{id: id, parentID: Uint32Max, branchID: branchID}
+	}
+	issues := data.Validate()
+	expected := []ValidationIssue{
+		{ID: 1, BranchID: "a", Check: CheckCaseFold, ConflictID: 2},
+		{ID: 2, BranchID: "A", Check: CheckCaseFold, ConflictID: 1},
+		{ID: 3, BranchID: "ab", Check: CheckCaseFold, ConflictID: 6},
+		{ID: 6, BranchID: "aB", Check: CheckCaseFold, ConflictID: 3},
+		{ID: 7, BranchID: "ab", Check: CheckCaseFold, ConflictID: 6},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %+v, instead held %+v", expected, issues)
+	}
+	for i := range expected {
+		if issues[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], issues[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteValidationCSV(&out, issues[:1]); err != nil {
+		t.Fatal(err)
+	}
+	verifyBranchID(t, "id,branch_id,check,conflict_id\n1,a,case_fold,2\n", out.String())
+}
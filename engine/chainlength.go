@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ChainProjection is the longest lineage chain a hierarchy needs, lengths are in characters and Depth is only known
+// when projecting
+type ChainProjection struct {
+	MaxLength int    `json:"maxLength"`
+	ID        uint32 `json:"id"`
+	Depth     int    `json:"depth"`
+}
+
+// ProjectChainLength works out the longest chain CalculateHierarchy would assign from the parent links alone, before
+// anything is calculated. Each sibling group adds as many characters as its size needs with the group's alphabet.
+// Records that can't be reached from a root aren't calculated and are left out.
+func (group *Group) ProjectChainLength() ChainProjection {
+	siblings := make(map[uint32]int)
+	for _, v := range group.Members {
+		siblings[v.GetParentID()]++
+	}
+	width := func(parentID uint32) int {
+		return siblingWidth(siblings[parentID], len(group.chars))
+	}
+
+	// lengths holds the chain length and depth of each record, -1 marks records that can't be reached
+	type projected struct {
+		length int
+		depth  int
+	}
+	lengths := make(map[uint32]projected, len(group.Members))
+	projection := ChainProjection{}
+	var path []uint32
+	for _, id := range group.sortedIDs() {
+		// Walk up until reaching a root or a record already projected
+		path = path[:0]
+		base := projected{}
+		reachable := true
+		for cur := id; ; {
+			if p, ok := lengths[cur]; ok {
+				base, reachable = p, p.length >= 0
+				break
+			}
+			// A path longer than the group can only be going round a loop
+			if len(path) > len(group.Members) {
+				reachable = false
+				break
+			}
+			path = append(path, cur)
+			parentID := group.Members[cur].GetParentID()
+			if parentID == Uint32Max {
+				break
+			}
+			if _, ok := group.Members[parentID]; !ok {
+				reachable = false
+				break
+			}
+			cur = parentID
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			if !reachable {
+				lengths[path[i]] = projected{length: -1}
+				continue
+			}
+			base = projected{
+				length: base.length + width(group.Members[path[i]].GetParentID()),
+				depth:  base.depth + 1,
+			}
+			lengths[path[i]] = base
+			if base.length > projection.MaxLength {
+				projection = ChainProjection{MaxLength: base.length, ID: path[i], Depth: base.depth}
+			}
+		}
+	}
+	return projection
+}
+
+// MaxChainLength is the longest chain held by the group's records, in characters
+func (group *Group) MaxChainLength() ChainProjection {
+	longest := ChainProjection{}
+	for _, id := range group.sortedIDs() {
+		if n := utf8.RuneCountInString(group.Members[id].GetBranchID()); n > longest.MaxLength {
+			longest = ChainProjection{MaxLength: n, ID: id}
+		}
+	}
+	return longest
+}
+
+// SplitChain splits a chain into parts of at most maxLength characters to spread it over several fields, a chain
+// that fits is returned as the only part
+func SplitChain(chain string, maxLength int) []string {
+	if maxLength <= 0 || utf8.RuneCountInString(chain) <= maxLength {
+		return []string{chain}
+	}
+	var parts []string
+	for len(chain) > 0 {
+		end, count := 0, 0
+		for end < len(chain) && count < maxLength {
+			_, size := utf8.DecodeRuneInString(chain[end:])
+			end += size
+			count++
+		}
+		parts = append(parts, chain[:end])
+		chain = chain[end:]
+	}
+	return parts
+}
+
+// JoinChain reassembles a chain read back from the fields it was split over, empty trailing parts are ignored
+func JoinChain(parts ...string) string {
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProjectChainLength(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	// 1 has more children than the test alphabet so its sibling group needs two characters
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, Uint32Max, "", ""},
+		{3, 2, "", ""},
+		{4, 3, "", ""},
+		{5, 99, "", ""},
+	}
+	for id := uint32(10); id < 10+uint32(len(chars))+1; id++ {
+		dataTable = append(dataTable, dataSeed{id, 1, "", ""})
+	}
+	data := verifyHierarchy(t, dataTable)
+	projection := data.ProjectChainLength()
+	expected := ChainProjection{MaxLength: 3, ID: 4, Depth: 3}
+	if projection != expected {
+		t.Errorf("Expected %+v, instead held %+v", expected, projection)
+	}
+	if actual := data.MaxChainLength(); actual.MaxLength != projection.MaxLength {
+		t.Errorf("Expected the projection to match the calculated %+v", actual)
+	}
+}
+
+func TestSplitChain(t *testing.T) {
+	chain := "aé" + strings.Repeat("b", 5)
+	parts := SplitChain(chain, 3)
+	expected := []string{"aéb", "bbb", "b"}
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %q, instead held %q", expected, parts)
+	}
+	for i := range expected {
+		verifyBranchID(t, expected[i], parts[i])
+	}
+	verifyBranchID(t, chain, JoinChain(parts...))
+	verifyBranchID(t, "abc", JoinChain(SplitChain("abc", 3)...))
+	if parts := SplitChain("abc", 0); len(parts) != 1 {
+		t.Errorf("Expected no split without a max length, instead held %q", parts)
+	}
+}
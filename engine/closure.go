@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// WriteClosureCSV streams the transitive closure of the hierarchy as ancestor_id,descendant_id,distance rows,
+// including each record paired with itself at distance 0. A maxDistance above 0 drops pairs further apart than that.
+// Only the current ancestor path is held in memory. Children must already be linked by CalculateHierarchy.
+func (group *Group) WriteClosureCSV(w io.Writer, maxDistance int) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"ancestor_id", "descendant_id", "distance"}); err != nil {
+		return err
+	}
+
+	var roots []uint32
+	for _, v := range group.Members {
+		if _, ok := group.Members[v.GetParentID()]; !ok {
+			roots = append(roots, v.GetID())
+		}
+	}
+	sortIDs(roots)
+
+	path := make([]string, 0)
+	row := make([]string, 3)
+	var walk func(id uint32) error
+	walk = func(id uint32) error {
+		descendant := strconv.FormatUint(uint64(id), 10)
+		path = append(path, descendant)
+		row[1] = descendant
+		for i := len(path) - 1; i >= 0; i-- {
+			distance := len(path) - 1 - i
+			if maxDistance > 0 && distance > maxDistance {
+				break
+			}
+			row[0] = path[i]
+			row[2] = strconv.Itoa(distance)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		for _, cID := range group.Members[id].GetChildren() {
+			if err := walk(cID); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		return nil
+	}
+	for _, id := range roots {
+		if err := walk(id); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteClosureCSV(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 2, "", ""},
+		{4, 1, "", ""},
+	}
+	data := verifyHierarchy(t, dataTable)
+
+	var b bytes.Buffer
+	if err := data.WriteClosureCSV(&b, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ancestor_id,descendant_id,distance\n1,1,0\n2,2,0\n1,2,1\n3,3,0\n2,3,1\n1,3,2\n4,4,0\n1,4,1\n"
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ninstead held\n%v", expected, b.String())
+	}
+
+	b.Reset()
+	if err := data.WriteClosureCSV(&b, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected = "ancestor_id,descendant_id,distance\n1,1,0\n2,2,0\n1,2,1\n3,3,0\n2,3,1\n4,4,0\n1,4,1\n"
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ninstead held\n%v", expected, b.String())
+	}
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// collationSkipScripts are the large scripts without contractions, their characters aren't paired up when looking
+// for contractions to keep building an alphabet quick
+var collationSkipScripts = []*unicode.RangeTable{unicode.Han, unicode.Hangul, unicode.Yi}
+
+// collatedChar is a candidate character of a collated alphabet with its primary collation key
+type collatedChar struct {
+	char   string
+	key    []byte
+	script *unicode.RangeTable
+}
+
+// ParseCollationLocale reads the BCP 47 tag of a collation locale, such as "en" or "de"
+func ParseCollationLocale(locale string) (language.Tag, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid collation locale %q: %v", locale, err)
+	}
+	return tag, nil
+}
+
+// CollatedChars orders and filters an alphabet so that sorting chains by code gives the same order as sorting them
+// with the locale's collation, the way Salesforce sorts text in ORDER BY. Only primary differences are reliable once
+// characters are strung together, so the characters kept are those that:
+//   - aren't ignored by the collation, like combining marks and format characters
+//   - don't share a primary weight with an earlier character, which also removes case and accent variants
+//   - don't collate as the start of another kept character's weights, like æ expanding to a e
+//   - don't start a contraction with a character of their own script, like ch in Slovak
+//
+// The result is ordered by collation.
+func CollatedChars(chars []string, locale string) ([]string, error) {
+	tag, err := ParseCollationLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	col := collate.New(tag, collate.Loose)
+	buf := &collate.Buffer{}
+	key := func(s string) []byte {
+		k := col.KeyFromString(buf, s)
+		out := make([]byte, len(k))
+		copy(out, k)
+		buf.Reset()
+		return out
+	}
+
+	candidates := make([]collatedChar, 0, len(chars))
+	for _, c := range chars {
+		k := key(c)
+		if len(k) == 0 {
+			continue
+		}
+		candidates = append(candidates, collatedChar{char: c, key: k, script: scriptOf([]rune(c)[0])})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return bytes.Compare(candidates[i].key, candidates[j].key) < 0 })
+
+	// Equal keys and keys extending a kept key sort straight after it
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if len(kept) > 0 && bytes.HasPrefix(c.key, kept[len(kept)-1].key) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+
+	byScript := make(map[*unicode.RangeTable][]collatedChar)
+	for _, c := range kept {
+		byScript[c.script] = append(byScript[c.script], c)
+	}
+	contractions := make(map[string]void)
+	for script, group := range byScript {
+		if skipCollationScript(script) {
+			continue
+		}
+		for _, x := range group {
+			for _, y := range group {
+				k := key(x.char + y.char)
+				if len(k) != len(x.key)+len(y.key) || !bytes.HasPrefix(k, x.key) || !bytes.HasSuffix(k, y.key) {
+					contractions[x.char] = emptyVal
+					break
+				}
+			}
+		}
+	}
+
+	collated := make([]string, 0, len(kept))
+	for _, c := range kept {
+		if _, ok := contractions[c.char]; !ok {
+			collated = append(collated, c.char)
+		}
+	}
+	return collated, nil
+}
+
+// scriptOf finds the script of a character, nil when it has none
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return table
+		}
+	}
+	return nil
+}
+
+func skipCollationScript(script *unicode.RangeTable) bool {
+	for _, s := range collationSkipScripts {
+		if s == script {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestCollatedChars(t *testing.T) {
+	alphabet := append([]string{"é", "æ", "ß", "́", "­", "-"}, chars...)
+	collated, err := CollatedChars(alphabet, "und")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the first of the accent and case variants is kept, expansions and ignorables are gone
+	verifyBranchID(t, "-0123456789abcdéfghijklmnopqrstuvwxyz늌", strings.Join(collated, ""))
+
+	// Slovak contracts ch, so c can't be followed by anything safely
+	collated, err = CollatedChars(chars, "sk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(collated, ""), "c") {
+		t.Errorf("Expected c to be removed for Slovak, instead held %q", collated)
+	}
+
+	for _, locale := range []string{"not a locale!", "cu-0-u-abcdefgh-en-us-0"} {
+		if _, err := CollatedChars(chars, locale); err == nil {
+			t.Errorf("Expected an error for the invalid locale %q", locale)
+		}
+	}
+}
+
+func TestCollatedChainOrder(t *testing.T) {
+	for _, locale := range []string{"und", "da", "sk", "de"} {
+		collated, err := CollatedChars(append([]string{"ä", "ø", "å", "ch"}, chars...), locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Random chains sorted by code must also be sorted by collation
+		rnd := rand.New(rand.NewSource(1))
+		position := make(map[string]int)
+		for i, c := range collated {
+			position[c] = i
+		}
+		chains := make([][]string, 500)
+		for i := range chains {
+			for n := rnd.Intn(6) + 1; n > 0; n-- {
+				chains[i] = append(chains[i], collated[rnd.Intn(len(collated))])
+			}
+		}
+		sort.Slice(chains, func(i, j int) bool {
+			a, b := chains[i], chains[j]
+			for k := 0; k < len(a) && k < len(b); k++ {
+				if a[k] != b[k] {
+					return position[a[k]] < position[b[k]]
+				}
+			}
+			return len(a) < len(b)
+		})
+		col := collate.New(language.MustParse(locale))
+		for i := 1; i < len(chains); i++ {
+			a, b := strings.Join(chains[i-1], ""), strings.Join(chains[i], "")
+			if a != b && col.CompareString(a, b) >= 0 {
+				t.Errorf("%s: expected %q to collate before %q", locale, a, b)
+			}
+		}
+	}
+}
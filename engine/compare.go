@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// HierarchyComparison compares a record's place in two hierarchies calculated over the same members, parents are
+// Uint32Max and depths 0 when the record has none in that hierarchy
+type HierarchyComparison struct {
+	ID               uint32
+	ParentA          uint32
+	ParentB          uint32
+	ParentsMatch     bool
+	DepthA           int
+	DepthB           int
+	DepthDifference  int
+	ParentBInUplineA bool
+}
+
+// ComparisonSummary aggregates the comparisons of every record
+type ComparisonSummary struct {
+	Records                int     `json:"records"`
+	ParentsMatch           int     `json:"parentsMatch"`
+	ParentBInUplineA       int     `json:"parentBInUplineA"`
+	DepthMismatch          int     `json:"depthMismatch"`
+	MaxDepthDifference     int     `json:"maxDepthDifference"`
+	MeanAbsDepthDifference float64 `json:"meanAbsDepthDifference"`
+}
+
+// CompareHierarchies compares every record found in both calculated hierarchies, handing each comparison to visit in
+// ID order so the results don't have to be held in memory
+func CompareHierarchies(a *Group, b *Group, visit func(HierarchyComparison) error) (ComparisonSummary, error) {
+	qa := NewQuery(a)
+	qb := NewQuery(b)
+	summary := ComparisonSummary{}
+	totalDepthDifference := 0
+	for _, id := range a.sortedIDs() {
+		rb, ok := b.Members[id]
+		if !ok {
+			continue
+		}
+		c := HierarchyComparison{ID: id, ParentA: a.Members[id].GetParentID(), ParentB: rb.GetParentID()}
+		if _, ok := a.Members[c.ParentA]; !ok {
+			c.ParentA = Uint32Max
+		}
+		if _, ok := b.Members[c.ParentB]; !ok {
+			c.ParentB = Uint32Max
+		}
+		c.ParentsMatch = c.ParentA == c.ParentB
+		c.DepthA, _ = qa.Depth(id)
+		c.DepthB, _ = qb.Depth(id)
+		c.DepthDifference = c.DepthA - c.DepthB
+		c.ParentBInUplineA = c.ParentB != Uint32Max && qa.IsAncestor(c.ParentB, id)
+
+		summary.Records++
+		if c.ParentsMatch {
+			summary.ParentsMatch++
+		}
+		if c.ParentBInUplineA {
+			summary.ParentBInUplineA++
+		}
+		difference := c.DepthDifference
+		if difference < 0 {
+			difference = -difference
+		}
+		if difference > 0 {
+			summary.DepthMismatch++
+		}
+		if difference > summary.MaxDepthDifference {
+			summary.MaxDepthDifference = difference
+		}
+		totalDepthDifference += difference
+		if err := visit(c); err != nil {
+			return summary, err
+		}
+	}
+	if summary.Records > 0 {
+		summary.MeanAbsDepthDifference = float64(totalDepthDifference) / float64(summary.Records)
+	}
+	return summary, nil
+}
+
+// WriteHierarchyComparisonCSV writes the comparison of every record found in both calculated hierarchies
+func WriteHierarchyComparisonCSV(w io.Writer, a *Group, b *Group) (ComparisonSummary, error) {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"id", "parent_a", "parent_b", "parents_match", "depth_a", "depth_b", "depth_difference", "parent_b_in_upline_a"})
+	if err != nil {
+		return ComparisonSummary{}, err
+	}
+	summary, err := CompareHierarchies(a, b, func(c HierarchyComparison) error {
+		return cw.Write([]string{
+			strconv.FormatUint(uint64(c.ID), 10),
+			formatParentID(c.ParentA),
+			formatParentID(c.ParentB),
+			strconv.FormatBool(c.ParentsMatch),
+			strconv.Itoa(c.DepthA),
+			strconv.Itoa(c.DepthB),
+			strconv.Itoa(c.DepthDifference),
+			strconv.FormatBool(c.ParentBInUplineA),
+		})
+	})
+	if err != nil {
+		return summary, err
+	}
+	cw.Flush()
+	return summary, cw.Error()
+}
+
+// formatParentID writes a parent ID, leaving it blank when there is none
+func formatParentID(id uint32) string {
+	if id == Uint32Max {
+		return ""
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,53 @@
+package engine
+
+import "testing"
+
+func TestCompareHierarchies(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	// id, sponsor, enroller
+	dataTable := [][3]uint32{
+		{1, Uint32Max, Uint32Max},
+		{2, 1, 1},
+		{3, 2, 1},
+		{4, 3, 2},
+		{5, 4, 4},
+	}
+	members := make(map[uint32]MultiRecord)
+	for _, tt := range dataTable {
+		members[tt[0]] = &multiRecord{id: tt[0], hierarchies: map[string]*record{
+			"sponsor":  {id: tt[0], parentID: tt[1]},
+			"enroller": {id: tt[0], parentID: tt[2]},
+		}}
+	}
+	groups := CalculateHierarchies(members, []string{"sponsor", "enroller"}, chars)
+
+	var comparisons []HierarchyComparison
+	summary, err := CompareHierarchies(groups["sponsor"], groups["enroller"], func(c HierarchyComparison) error {
+		comparisons = append(comparisons, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []HierarchyComparison{
+		{1, Uint32Max, Uint32Max, true, 1, 1, 0, false},
+		{2, 1, 1, true, 2, 2, 0, true},
+		{3, 2, 1, false, 3, 2, 1, true},
+		{4, 3, 2, false, 4, 3, 1, true},
+		{5, 4, 4, true, 5, 4, 1, true},
+	}
+	if len(comparisons) != len(expected) {
+		t.Fatalf("Expected %v comparisons, instead held %v", len(expected), len(comparisons))
+	}
+	for i := range expected {
+		if comparisons[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], comparisons[i])
+		}
+	}
+	expectedSummary := ComparisonSummary{Records: 5, ParentsMatch: 3, ParentBInUplineA: 4, DepthMismatch: 3, MaxDepthDifference: 1, MeanAbsDepthDifference: 0.6}
+	if summary != expectedSummary {
+		t.Errorf("Expected %+v, instead held %+v", expectedSummary, summary)
+	}
+}
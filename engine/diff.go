@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// ChangeKind classifies how a record differs between two snapshots
+type ChangeKind string
+
+const (
+	// ChangeInsert is a record only found in the later snapshot
+	ChangeInsert ChangeKind = "insert"
+	// ChangeDelete is a record only found in the earlier snapshot
+	ChangeDelete ChangeKind = "delete"
+	// ChangeReparent is a record that moved to a different parent, taking its downline with it
+	ChangeReparent ChangeKind = "reparent"
+	// ChangeDepth is a record that kept its parent but sits at a different depth because an ancestor moved
+	ChangeDepth ChangeKind = "depth"
+	// ChangeBranchID is a record that kept its parent and depth but received a different branch ID
+	ChangeBranchID ChangeKind = "branch_id"
+)
+
+// Change describes a single record that differs between two snapshots. Parents are Uint32Max when there is none,
+// SubtreeSize counts the moved record and its downline in the later snapshot and is only set for re-parents.
+type Change struct {
+	Kind        ChangeKind
+	ID          uint32
+	OldParentID uint32
+	NewParentID uint32
+	OldDepth    int
+	NewDepth    int
+	OldBranchID string
+	NewBranchID string
+	SubtreeSize int
+}
+
+// DiffSummary counts the changes of each kind
+type DiffSummary map[ChangeKind]int
+
+// DiffSnapshots compares two snapshots record by record, handing each change to visit in ID order
+func DiffSnapshots(before *Snapshot, after *Snapshot, visit func(Change) error) (DiffSummary, error) {
+	summary := DiffSummary{}
+	ids := make([]uint32, 0, len(after.group.Members))
+	for id := range after.group.Members {
+		ids = append(ids, id)
+	}
+	for id := range before.group.Members {
+		if _, ok := after.group.Members[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+
+	for _, id := range ids {
+		o, inOld := before.Record(id)
+		n, inNew := after.Record(id)
+		c := Change{ID: id, OldParentID: Uint32Max, NewParentID: Uint32Max}
+		if inOld {
+			c.OldParentID, c.OldDepth, c.OldBranchID = o.ParentID, o.Depth, o.BranchID
+		}
+		if inNew {
+			c.NewParentID, c.NewDepth, c.NewBranchID = n.ParentID, n.Depth, n.BranchID
+		}
+		switch {
+		case !inOld:
+			c.Kind = ChangeInsert
+		case !inNew:
+			c.Kind = ChangeDelete
+		case c.OldParentID != c.NewParentID:
+			c.Kind = ChangeReparent
+			c.SubtreeSize = after.query.DescendantCount(id) + 1
+		case c.OldDepth != c.NewDepth:
+			c.Kind = ChangeDepth
+		case c.OldBranchID != c.NewBranchID:
+			c.Kind = ChangeBranchID
+		default:
+			continue
+		}
+		summary[c.Kind]++
+		if err := visit(c); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// WriteDiffCSV writes every change between two snapshots as a CSV row
+func WriteDiffCSV(w io.Writer, before *Snapshot, after *Snapshot) (DiffSummary, error) {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"kind", "id", "old_parent_id", "new_parent_id", "old_depth", "new_depth",
+		"old_branch_id", "new_branch_id", "subtree_size"})
+	if err != nil {
+		return nil, err
+	}
+	summary, err := DiffSnapshots(before, after, func(c Change) error {
+		return cw.Write([]string{
+			string(c.Kind),
+			strconv.FormatUint(uint64(c.ID), 10),
+			formatParentID(c.OldParentID),
+			formatParentID(c.NewParentID),
+			strconv.Itoa(c.OldDepth),
+			strconv.Itoa(c.NewDepth),
+			c.OldBranchID,
+			c.NewBranchID,
+			strconv.Itoa(c.SubtreeSize),
+		})
+	})
+	if err != nil {
+		return summary, err
+	}
+	cw.Flush()
+	return summary, cw.Error()
+}
+
+// jsonChange is the NDJSON form of a Change, leaving out parents that don't exist
+type jsonChange struct {
+	Kind        ChangeKind `json:"kind"`
+	ID          uint32     `json:"id"`
+	OldParentID *uint32    `json:"oldParentId,omitempty"`
+	NewParentID *uint32    `json:"newParentId,omitempty"`
+	OldDepth    int        `json:"oldDepth"`
+	NewDepth    int        `json:"newDepth"`
+	OldBranchID string     `json:"oldBranchId"`
+	NewBranchID string     `json:"newBranchId"`
+	SubtreeSize int        `json:"subtreeSize,omitempty"`
+}
+
+// WriteDiffNDJSON writes every change between two snapshots as one JSON object per line
+func WriteDiffNDJSON(w io.Writer, before *Snapshot, after *Snapshot) (DiffSummary, error) {
+	enc := json.NewEncoder(w)
+	return DiffSnapshots(before, after, func(c Change) error {
+		jc := jsonChange{
+			Kind:        c.Kind,
+			ID:          c.ID,
+			OldDepth:    c.OldDepth,
+			NewDepth:    c.NewDepth,
+			OldBranchID: c.OldBranchID,
+			NewBranchID: c.NewBranchID,
+			SubtreeSize: c.SubtreeSize,
+		}
+		if c.OldParentID != Uint32Max {
+			jc.OldParentID = &c.OldParentID
+		}
+		if c.NewParentID != Uint32Max {
+			jc.NewParentID = &c.NewParentID
+		}
+		return enc.Encode(jc)
+	})
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{4, 2, "", ""},
+		{5, 4, "", ""},
+		{6, 3, "", ""},
+		{7, 3, "", ""},
+	}
+	data := verifyHierarchy(t, dataTable)
+	before := data.Snapshot()
+
+	// Move 4 and its downline under 3, drop 7 and add 8
+	data.Members[4].(*record).parentID = 3
+	delete(data.Members, 7)
+	data.Members[8] = &record{id: 8, parentID: 1}
+	data.CalculateHierarchy()
+	after := data.Snapshot()
+
+	var changes []Change
+	summary, err := DiffSnapshots(before, after, func(c Change) error {
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Change{
+		{Kind: ChangeReparent, ID: 4, OldParentID: 2, NewParentID: 3, OldDepth: 3, NewDepth: 3, OldBranchID: "aaa", NewBranchID: "abb", SubtreeSize: 2},
+		{Kind: ChangeBranchID, ID: 5, OldParentID: 4, NewParentID: 4, OldDepth: 4, NewDepth: 4, OldBranchID: "aaaa", NewBranchID: "abba"},
+		{Kind: ChangeDelete, ID: 7, OldParentID: 3, NewParentID: Uint32Max, OldDepth: 3, OldBranchID: "abb"},
+		{Kind: ChangeInsert, ID: 8, OldParentID: Uint32Max, NewParentID: 1, NewDepth: 2, NewBranchID: "ac"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %+v, instead held %+v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], changes[i])
+		}
+	}
+	if summary[ChangeReparent] != 1 || summary[ChangeInsert] != 1 || summary[ChangeDelete] != 1 || summary[ChangeBranchID] != 1 {
+		t.Errorf("Unexpected summary %v", summary)
+	}
+
+	var b bytes.Buffer
+	if _, err := WriteDiffNDJSON(&b, before, after); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[2], `"kind":"delete"`) || strings.Contains(lines[2], "newParentId") {
+		t.Errorf("Unexpected NDJSON %v", b.String())
+	}
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 )
@@ -20,9 +21,13 @@ var (
 
 // Group of members and their related eligible chain characters
 type Group struct {
-	Members map[uint32]Record
-	chars   []string
-	charMap map[rune]void
+	Members  map[uint32]Record
+	chars    []string
+	charMap  map[rune]void
+	traceIDs []uint32
+	tracing  map[uint32]*TraceStep
+	// idOrder hands out sibling codes in ID order instead of the order the members are linked in
+	idOrder bool
 }
 
 // SetChars is used to assign the available character for building the Branch ID
@@ -34,6 +39,12 @@ func (group *Group) SetChars(chars []string) {
 	}
 }
 
+// SetIDOrder hands out the codes of new siblings in ID order so repeated runs over the same records assign the same
+// chains. Switching it on for an existing hierarchy can reassign the codes of records whose chains aren't kept.
+func (group *Group) SetIDOrder(idOrder bool) {
+	group.idOrder = idOrder
+}
+
 // CalculateHierarchy calculates a tree hierarchy given a list of records, optional list of characters to use to build lineage chain
 func (group *Group) CalculateHierarchy() {
 	// Used to report the memory size of the struct for optimization purposes
@@ -83,9 +94,19 @@ func (group *Group) CalculateHierarchy() {
 			}
 		}
 	}
+	if group.idOrder {
+		sortIDs(parents)
+		for _, v := range group.Members {
+			if len(v.GetChildren()) > 1 {
+				sortIDs(v.GetChildren())
+			}
+		}
+	}
 	TimeTrack(startLinkParents, "Linking Parents")
 	PrintMemUsage()
 
+	group.startTracing()
+
 	// Start calculating ids with a blank starting value
 	startCalcLineageChain := time.Now()
 	group.calculateLineageChain("", parents, 1)
@@ -100,16 +121,15 @@ func (group *Group) CalculateHierarchy() {
 
 func (group *Group) calculateLineageChain(parentChain string, children []uint32, depth int) {
 	// Determine how many characters wide are needed for this sibling group
-	widthNeeded := 1
-	childCount := len(children)
-	for childCount > len(group.chars) {
-		widthNeeded++
-		childCount = childCount / len(group.chars)
-	}
+	widthNeeded := siblingWidth(len(children), len(group.chars))
 
+	tracing := group.tracing != nil
 	for _, cID := range children {
 		c := group.Members[cID]
 		childBranchID := group.Members[cID].GetBranchID()
+		if tracing {
+			group.traceSiblingGroup(cID, len(children), widthNeeded)
+		}
 
 		// evalute all of the chars in the current Branch ID, if any of them are not in the current char map, burn the Branch ID
 		if len([]rune(childBranchID)) > 0 {
@@ -117,6 +137,9 @@ func (group *Group) calculateLineageChain(parentChain string, children []uint32,
 				if _, has := group.charMap[r]; !has {
 					c.SetBranchID("")
 					group.Members[cID] = c
+					if tracing {
+						group.traceReason(cID, TraceInvalidChars)
+					}
 					break
 				}
 			}
@@ -157,14 +180,26 @@ func (group *Group) calculateLineageChain(parentChain string, children []uint32,
 					if _, used := usedChars[childBranchUniqueParts]; !used {
 						// Mark is as claimed
 						usedChars[childBranchUniqueParts] = emptyVal
+						if tracing {
+							group.traceReason(cID, TraceKept)
+						}
 					} else {
 						c.SetBranchID("")
+						if tracing {
+							group.traceReason(cID, TraceClaimedBySibling)
+						}
 					}
 				} else {
 					c.SetBranchID("")
+					if tracing {
+						group.traceReason(cID, TraceWidthMismatch)
+					}
 				}
 			} else {
 				c.SetBranchID("")
+				if tracing {
+					group.traceReason(cID, TraceNotUnderParent)
+				}
 			}
 		}
 		// init string with value of parent
@@ -190,6 +225,9 @@ func (group *Group) calculateLineageChain(parentChain string, children []uint32,
 
 		c.SetBranchDepth(uint8(depth))
 		group.Members[cID] = c
+		if tracing {
+			group.traceAssigned(cID, c.GetBranchID())
+		}
 		if len(c.GetChildren()) > 0 {
 			// Use recurssion to start processing this record's children
 			group.calculateLineageChain(c.GetBranchID(), c.GetChildren(), depth+1)
@@ -197,6 +235,20 @@ func (group *Group) calculateLineageChain(parentChain string, children []uint32,
 	}
 }
 
+// siblingWidth is the number of characters each code of a sibling group is built from
+func siblingWidth(siblings int, alphabet int) int {
+	width := 1
+	for siblings > alphabet {
+		width++
+		siblings = siblings / alphabet
+	}
+	return width
+}
+
+func sortIDs(ids []uint32) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
 func increaseCharPos(charPosList []int, chars []string) []int {
 	charPosList[0]++
 
@@ -235,6 +235,7 @@ func verifyHierarchy(t *testing.T, dataTable []dataSeed) Group {
 	data := Group{}
 	data.Members = make(map[uint32]Record)
 	data.SetChars(chars)
+	data.SetIDOrder(true)
 	branchKeys := make(map[string]bool)
 
 	for _, tt := range dataTable {
@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// DefaultExternalMemoryLimit is the memory cap of CalculateExternal when none is configured
+const DefaultExternalMemoryLimit = int64(256 << 20)
+
+// ExternalRecord is a record streamed through CalculateExternal. ParentID is Uint32Max for a root, BranchID is the
+// previous chain on the way in and the calculated one on the way out, Depth is only set on the way out.
+type ExternalRecord struct {
+	ID       uint32
+	ParentID uint32
+	BranchID string
+	Depth    uint8
+	// Payload is carried through to emit unchanged so callers can match emitted records back to their own data
+	// without holding it in memory
+	Payload string
+}
+
+// ExternalOptions tune CalculateExternal
+type ExternalOptions struct {
+	// Dir is where spill files are written, the system temp directory when empty
+	Dir string
+	// MemoryLimit caps the bytes of records buffered at once, DefaultExternalMemoryLimit when 0. The largest
+	// sibling group and a read buffer per spilled run are held on top of it.
+	MemoryLimit int64
+}
+
+// CalculateExternal calculates the same lineage chains and depths as CalculateHierarchy without holding the
+// hierarchy in memory. Records are read from next until it returns io.EOF, spilled to disk in sorted runs by
+// parent ID and then calculated a level at a time, handing every reachable record to emit in level order.
+// Records that can't be reached from a root aren't emitted, the same records CalculateHierarchy leaves untouched.
+func CalculateExternal(next func() (ExternalRecord, error), chars []string, opts ExternalOptions,
+	emit func(ExternalRecord) error) error {
+	if len(chars) == 0 {
+		return fmt.Errorf("no characters to build lineage chains with")
+	}
+	limit := opts.MemoryLimit
+	if limit <= 0 {
+		limit = DefaultExternalMemoryLimit
+	}
+	dir, err := ioutil.TempDir(opts.Dir, "hierarchy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	input := &runSorter{less: byParent, limit: limit, dir: dir}
+	for {
+		r, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := input.add(r); err != nil {
+			return err
+		}
+	}
+	pending, err := input.finish()
+	if err != nil {
+		return err
+	}
+
+	calc := &Group{idOrder: true}
+	calc.SetChars(chars)
+	// The roots are the children of a parent that doesn't exist, give it an empty chain
+	var frontier recordSource = singleRecord(ExternalRecord{ID: Uint32Max})
+	var frontierRuns []string
+	var frontierMerge *runMerge
+	for depth := 1; ; depth++ {
+		level := &externalLevel{
+			calc:     calc,
+			depth:    depth,
+			frontier: frontier,
+			next:     &runSorter{less: byID, limit: limit, dir: dir},
+			emit:     emit,
+		}
+		remaining, err := level.calculate(pending, dir)
+		removeRuns(pending)
+		if frontierMerge != nil {
+			frontierMerge.close()
+			removeRuns(frontierRuns)
+		}
+		if err != nil {
+			return err
+		}
+		pending = []string{remaining}
+
+		// The records calculated on this level are the parents of the next one
+		if frontierRuns, err = level.next.finish(); err != nil {
+			return err
+		}
+		if len(frontierRuns) == 0 {
+			return nil
+		}
+		if frontierMerge, err = mergeRuns(frontierRuns, byID); err != nil {
+			return err
+		}
+		frontier = frontierMerge.next
+	}
+}
+
+// singleRecord is a source of just one record
+func singleRecord(r ExternalRecord) recordSource {
+	done := false
+	return func() (ExternalRecord, error) {
+		if done {
+			return ExternalRecord{}, io.EOF
+		}
+		done = true
+		return r, nil
+	}
+}
+
+// externalLevel calculates the records whose parents were calculated on the level before
+type externalLevel struct {
+	calc      *Group
+	depth     int
+	frontier  recordSource
+	next      *runSorter
+	emit      func(ExternalRecord) error
+	parent    ExternalRecord
+	parentErr error
+	started   bool
+}
+
+// calculate reads the pending records in parent order, calculating the sibling groups whose parent is on the
+// frontier and spilling the rest to a new pending file
+func (l *externalLevel) calculate(pending []string, dir string) (string, error) {
+	merge, err := mergeRuns(pending, byParent)
+	if err != nil {
+		return "", err
+	}
+	defer merge.close()
+	remaining, err := createSpillFile(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var siblings []ExternalRecord
+	flush := func() error {
+		if len(siblings) == 0 {
+			return nil
+		}
+		parent, found, err := l.findParent(siblings[0].ParentID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			for i := range siblings {
+				if err := remaining.write(&siblings[i]); err != nil {
+					return err
+				}
+			}
+		} else if err := l.calculateSiblings(parent.BranchID, siblings); err != nil {
+			return err
+		}
+		siblings = siblings[:0]
+		return nil
+	}
+	for {
+		r, err := merge.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			remaining.close()
+			return "", err
+		}
+		if len(siblings) > 0 && siblings[0].ParentID != r.ParentID {
+			if err := flush(); err != nil {
+				remaining.close()
+				return "", err
+			}
+		}
+		siblings = append(siblings, r)
+	}
+	if err := flush(); err != nil {
+		remaining.close()
+		return "", err
+	}
+	return remaining.close()
+}
+
+// findParent advances the frontier to the parent, both are read in ID order so the frontier is only read once
+func (l *externalLevel) findParent(id uint32) (ExternalRecord, bool, error) {
+	if !l.started {
+		l.parent, l.parentErr = l.frontier()
+		l.started = true
+	}
+	for l.parentErr == nil && l.parent.ID < id {
+		l.parent, l.parentErr = l.frontier()
+	}
+	if l.parentErr != nil && l.parentErr != io.EOF {
+		return ExternalRecord{}, false, l.parentErr
+	}
+	return l.parent, l.parentErr == nil && l.parent.ID == id, nil
+}
+
+// calculateSiblings assigns the chains of a sibling group with the same rules CalculateHierarchy uses
+func (l *externalLevel) calculateSiblings(parentChain string, siblings []ExternalRecord) error {
+	ids := make([]uint32, len(siblings))
+	l.calc.Members = make(map[uint32]Record, len(siblings))
+	for i := range siblings {
+		ids[i] = siblings[i].ID
+		l.calc.Members[ids[i]] = &simulatedRecord{id: ids[i], parentID: siblings[i].ParentID, branchID: siblings[i].BranchID}
+	}
+	l.calc.calculateLineageChain(parentChain, ids, l.depth)
+	for i := range siblings {
+		r := l.calc.Members[ids[i]].(*simulatedRecord)
+		siblings[i].BranchID, siblings[i].Depth = r.branchID, r.depth
+		if err := l.emit(siblings[i]); err != nil {
+			return err
+		}
+		// The next level only needs the chain of its parents
+		parent := siblings[i]
+		parent.Payload = ""
+		if err := l.next.add(parent); err != nil {
+			return err
+		}
+	}
+	l.calc.Members = nil
+	return nil
+}
+
+// CalculateExternalCSV runs CalculateExternal over a CSV with an id, parent_id, branch_id header, an empty parent_id
+// being a root, and writes id, parent_id, branch_id, depth rows in level order
+func CalculateExternalCSV(r io.Reader, w io.Writer, chars []string, opts ExternalOptions) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"id", "parent_id", "branch_id"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("external input is missing the %s column", name)
+		}
+	}
+	line := 1
+	next := func() (ExternalRecord, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return ExternalRecord{}, err
+		}
+		line++
+		id, err := strconv.ParseUint(row[columns["id"]], 10, 32)
+		if err != nil {
+			return ExternalRecord{}, fmt.Errorf("line %d: invalid id: %v", line, err)
+		}
+		rec := ExternalRecord{ID: uint32(id), ParentID: Uint32Max, BranchID: row[columns["branch_id"]]}
+		if v := row[columns["parent_id"]]; v != "" {
+			parentID, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return ExternalRecord{}, fmt.Errorf("line %d: invalid parent_id: %v", line, err)
+			}
+			rec.ParentID = uint32(parentID)
+		}
+		return rec, nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "parent_id", "branch_id", "depth"}); err != nil {
+		return err
+	}
+	err = CalculateExternal(next, chars, opts, func(rec ExternalRecord) error {
+		return cw.Write([]string{
+			strconv.FormatUint(uint64(rec.ID), 10),
+			formatParentID(rec.ParentID),
+			rec.BranchID,
+			strconv.Itoa(int(rec.Depth)),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCalculateExternal(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	// A few hundred records under a handful of roots, plus orphans whose parent isn't loaded
+	rnd := rand.New(rand.NewSource(1))
+	var input []ExternalRecord
+	for id := uint32(1); id <= 600; id++ {
+		parentID := Uint32Max
+		switch {
+		case id%97 == 0:
+			parentID = 10000 + id
+		case id > 5:
+			parentID = uint32(rnd.Intn(int(id)-1)) + 1
+		}
+		input = append(input, ExternalRecord{ID: id, ParentID: parentID, Payload: fmt.Sprintf("sf-%d", id)})
+	}
+
+	calculate := func(input []ExternalRecord) *Group {
+		group := &Group{Members: make(map[uint32]Record)}
+		group.SetChars(chars)
+		group.SetIDOrder(true)
+		for _, r := range input {
+			group.Members[r.ID] = &simulatedRecord{id: r.ID, parentID: r.ParentID, branchID: r.BranchID}
+		}
+		group.CalculateHierarchy()
+		return group
+	}
+	verify := func(input []ExternalRecord) {
+		expected := calculate(input)
+		i := 0
+		emitted := make(map[uint32]ExternalRecord)
+		err := CalculateExternal(func() (ExternalRecord, error) {
+			if i == len(input) {
+				return ExternalRecord{}, io.EOF
+			}
+			i++
+			return input[i-1], nil
+		}, chars, ExternalOptions{MemoryLimit: 2048}, func(r ExternalRecord) error {
+			if _, ok := emitted[r.ID]; ok {
+				t.Errorf("Record %d emitted twice", r.ID)
+			}
+			emitted[r.ID] = r
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, v := range expected.Members {
+			e := v.(*simulatedRecord)
+			r, ok := emitted[id]
+			if e.depth == 0 {
+				if ok {
+					t.Errorf("Expected unreachable record %d to not be emitted", id)
+				}
+				continue
+			}
+			if !ok {
+				t.Errorf("Expected record %d to be emitted", id)
+				continue
+			}
+			verifyBranchID(t, e.branchID, r.BranchID)
+			if r.Payload != fmt.Sprintf("sf-%d", id) {
+				t.Errorf("Expected %d to carry its payload, instead held %q", id, r.Payload)
+			}
+			if r.Depth != e.depth {
+				t.Errorf("Expected %d at depth %d, instead held %d", id, e.depth, r.Depth)
+			}
+		}
+	}
+	verify(input)
+
+	// Recalculate from the previous chains after moving some records, so kept and reassigned chains both occur
+	previous := calculate(input)
+	for i := range input {
+		input[i].BranchID = previous.Members[input[i].ID].GetBranchID()
+		if i%50 == 10 {
+			input[i].ParentID = 1
+		}
+	}
+	verify(input)
+}
+
+func TestCalculateExternalCSV(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	in := "id,parent_id,branch_id\n3,1,\n1,,\n2,1,ab\n4,99,\n"
+	var out bytes.Buffer
+	if err := CalculateExternalCSV(strings.NewReader(in), &out, chars, ExternalOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,parent_id,branch_id,depth\n1,,a,1\n2,1,ab,2\n3,1,aa,2\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, instead held %q", expected, out.String())
+	}
+}
+
+func TestSpillRecordSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sw, err := createSpillFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooLong := &ExternalRecord{ID: 1, BranchID: strings.Repeat("a", maxStoredBranchIDLength+1)}
+	if err := sw.write(tooLong); err != errSpillRecordSize {
+		t.Errorf("Expected a record size error, instead held %v", err)
+	}
+	path, err := sw.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupt branch ID length is rejected before anything is allocated for it
+	corrupt := []byte("\x01\x00\x01\xff\xff\xff\xff\xff\xff\xff\xff\x7f\x00")
+	if err := ioutil.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := openSpillFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.f.Close()
+	if _, err := sr.next(); err != errSpillRecordSize {
+		t.Errorf("Expected a record size error, instead held %v", err)
+	}
+}
+
+func TestRunSorterFinish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Records that fit a single buffer are only spilled by finish, their run must be returned
+	rs := &runSorter{less: byParent, limit: DefaultExternalMemoryLimit, dir: dir}
+	for id := uint32(1); id <= 3; id++ {
+		if err := rs.add(ExternalRecord{ID: id, ParentID: Uint32Max}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := rs.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Errorf("Expected the buffered records in 1 run, instead held %d runs", len(runs))
+	}
+}
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const (
+	// fingerprintSize is the number of hash bytes kept in an alphabet fingerprint
+	fingerprintSize = 8
+	// maxFingerprintLength bounds the fingerprints read from snapshot files, the hex of a whole hash
+	maxFingerprintLength = 2 * sha256.Size
+)
+
+// AlphabetFingerprint identifies an alphabet by its characters and their order. Chains built from alphabets with the
+// same fingerprint use the same characters, a different fingerprint means stored chains may hold characters the
+// alphabet no longer has.
+func AlphabetFingerprint(chars []string) string {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	for _, c := range chars {
+		// Length prefixes keep "ab" apart from "a", "b"
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(c)))])
+		h.Write([]byte(c))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:fingerprintSize])
+}
+
+// AlphabetFingerprint identifies the alphabet the group builds chains from
+func (group *Group) AlphabetFingerprint() string {
+	return AlphabetFingerprint(group.chars)
+}
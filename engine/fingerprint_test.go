@@ -0,0 +1,28 @@
+package engine
+
+import "testing"
+
+func TestAlphabetFingerprint(t *testing.T) {
+	base := AlphabetFingerprint([]string{"a", "b", "c"})
+	if len(base) != 2*fingerprintSize {
+		t.Errorf("Expected a %d character fingerprint, instead held %q", 2*fingerprintSize, base)
+	}
+	if AlphabetFingerprint([]string{"a", "b", "c"}) != base {
+		t.Errorf("Expected the same alphabet to give the same fingerprint")
+	}
+	tests := [][]string{
+		{"a", "c", "b"},
+		{"a", "b"},
+		{"a", "b", "c", "d"},
+		{"ab", "c"},
+	}
+	for _, chars := range tests {
+		if AlphabetFingerprint(chars) == base {
+			t.Errorf("Expected %v to have a different fingerprint than a, b, c", chars)
+		}
+	}
+
+	group := &Group{}
+	group.SetChars(chars)
+	assertBoolean(t, true, group.AlphabetFingerprint() == AlphabetFingerprint(chars))
+}
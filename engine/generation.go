@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// GenerationRecord is an optional Record extension that holds the number of descendants at each level below the record
+type GenerationRecord interface {
+	GetGenerationCounts() []uint32
+	SetGenerationCounts([]uint32)
+}
+
+// CalculateGenerationCounts counts, for every record, how many descendants sit at level 1, 2, ... levels below it.
+// Children must already be linked by CalculateHierarchy. Records that implement GenerationRecord receive the counts.
+// A negative number of levels is treated as 0.
+func (group *Group) CalculateGenerationCounts(levels int) {
+	if levels < 0 {
+		levels = 0
+	}
+	for _, v := range group.Members {
+		if _, ok := group.Members[v.GetParentID()]; ok {
+			continue
+		}
+		group.calculateGenerationCounts(v.GetID(), levels)
+	}
+}
+
+func (group *Group) calculateGenerationCounts(id uint32, levels int) []uint32 {
+	r := group.Members[id]
+	counts := make([]uint32, levels)
+	if levels > 0 {
+		counts[0] = uint32(len(r.GetChildren()))
+	}
+	for _, cID := range r.GetChildren() {
+		childCounts := group.calculateGenerationCounts(cID, levels)
+		// The child's generations are one level further away from this record
+		for i := 0; i < levels-1; i++ {
+			counts[i+1] += childCounts[i]
+		}
+	}
+	if gr, ok := r.(GenerationRecord); ok {
+		gr.SetGenerationCounts(counts)
+		group.Members[id] = r
+	}
+	return counts
+}
+
+// WriteGenerationCountsCSV writes the generation counts of every record implementing GenerationRecord as
+// id,level_1,...,level_N rows ordered by ID
+func (group *Group) WriteGenerationCountsCSV(w io.Writer, levels int) error {
+	if levels < 0 {
+		levels = 0
+	}
+	cw := csv.NewWriter(w)
+	header := make([]string, levels+1)
+	header[0] = "id"
+	for i := 1; i <= levels; i++ {
+		header[i] = "level_" + strconv.Itoa(i)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, levels+1)
+	for _, id := range group.sortedIDs() {
+		gr, ok := group.Members[id].(GenerationRecord)
+		if !ok {
+			continue
+		}
+		counts := gr.GetGenerationCounts()
+		row[0] = strconv.FormatUint(uint64(id), 10)
+		for i := 0; i < levels; i++ {
+			row[i+1] = "0"
+			if i < len(counts) {
+				row[i+1] = strconv.FormatUint(uint64(counts[i]), 10)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sortedIDs returns the IDs of all members in ascending order
+func (group *Group) sortedIDs() []uint32 {
+	ids := make([]uint32, 0, len(group.Members))
+	for id := range group.Members {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCalculateGenerationCounts(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{4, 2, "", ""},
+		{5, 2, "", ""},
+		{6, 4, "", ""},
+		{7, 6, "", ""},
+	}
+
+	data := verifyHierarchy(t, dataTable)
+	data.CalculateGenerationCounts(3)
+
+	assertUint32s(t, []uint32{2, 2, 1}, data.Members[1].(*record).GetGenerationCounts())
+	assertUint32s(t, []uint32{2, 1, 1}, data.Members[2].(*record).GetGenerationCounts())
+	assertUint32s(t, []uint32{0, 0, 0}, data.Members[3].(*record).GetGenerationCounts())
+	assertUint32s(t, []uint32{1, 1, 0}, data.Members[4].(*record).GetGenerationCounts())
+
+	var b bytes.Buffer
+	if err := data.WriteGenerationCountsCSV(&b, 2); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,level_1,level_2\n1,2,2\n2,2,1\n3,0,0\n4,1,1\n5,0,0\n6,1,0\n7,0,0\n"
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ninstead held\n%v", expected, b.String())
+	}
+
+	// Negative levels count nothing
+	data.CalculateGenerationCounts(-1)
+	assertUint32s(t, []uint32{}, data.Members[1].(*record).GetGenerationCounts())
+	b.Reset()
+	if err := data.WriteGenerationCountsCSV(&b, -2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("id\n1\n")) {
+		t.Errorf("Expected an ID only CSV, instead held\n%v", b.String())
+	}
+}
+
+func assertUint32s(t *testing.T, expected []uint32, actual []uint32) {
+	if len(expected) != len(actual) {
+		t.Errorf("Expected %v, instead held %v", expected, actual)
+		return
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("Expected %v, instead held %v", expected, actual)
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// HistoryDateLayout is the layout of the dates in a parent history CSV
+const HistoryDateLayout = "2006-01-02"
+
+// ParentPeriod is a parent a record had from From up to but not including To, a zero To is still in effect.
+// A ParentID of Uint32Max makes the record a root for the period.
+type ParentPeriod struct {
+	ParentID uint32
+	From     time.Time
+	To       time.Time
+}
+
+// covers reports whether the period was in effect on the date
+func (p ParentPeriod) covers(date time.Time) bool {
+	return !date.Before(p.From) && (p.To.IsZero() || date.Before(p.To))
+}
+
+// ParentHistory holds the dated parents of each record by record ID, a record only exists on the dates covered by
+// one of its periods
+type ParentHistory map[uint32][]ParentPeriod
+
+// Add records a period of a record's parent history
+func (h ParentHistory) Add(id uint32, period ParentPeriod) {
+	h[id] = append(h[id], period)
+}
+
+// ParentAsOf returns the parent a record had on the date, when periods overlap the one starting last wins. ok is
+// false when the record didn't exist on the date.
+func (h ParentHistory) ParentAsOf(id uint32, date time.Time) (parentID uint32, ok bool) {
+	var from time.Time
+	for _, p := range h[id] {
+		if p.covers(date) && (!ok || !p.From.Before(from)) {
+			parentID, from, ok = p.ParentID, p.From, true
+		}
+	}
+	return parentID, ok
+}
+
+// GroupAsOf builds the hierarchy as it was on the date. Records whose parent didn't exist on the date become roots.
+// When previous is given its branch IDs seed the group so records keep their chains from one period to the next.
+func (h ParentHistory) GroupAsOf(date time.Time, chars []string, previous *Snapshot) *Group {
+	group := &Group{Members: make(map[uint32]Record), idOrder: true}
+	group.SetChars(chars)
+	for id := range h {
+		parentID, ok := h.ParentAsOf(id, date)
+		if !ok {
+			continue
+		}
+		r := &simulatedRecord{id: id, parentID: parentID}
+		if previous != nil {
+			if p, ok := previous.Record(id); ok {
+				r.branchID = p.BranchID
+			}
+		}
+		group.Members[id] = r
+	}
+	for _, v := range group.Members {
+		r := v.(*simulatedRecord)
+		if _, ok := group.Members[r.parentID]; !ok {
+			r.parentID = Uint32Max
+		}
+	}
+	return group
+}
+
+// CalculateAsOf calculates the lineage chains and depths of the hierarchy as it was on the date
+func (h ParentHistory) CalculateAsOf(date time.Time, chars []string, previous *Snapshot) *Snapshot {
+	group := h.GroupAsOf(date, chars, previous)
+	group.CalculateHierarchy()
+	return group.Snapshot()
+}
+
+// MonthEnds lists the last day of every month from the month of from through the month of to
+func MonthEnds(from time.Time, to time.Time) []time.Time {
+	var dates []time.Time
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for !month.After(to) {
+		next := month.AddDate(0, 1, 0)
+		dates = append(dates, next.AddDate(0, 0, -1))
+		month = next
+	}
+	return dates
+}
+
+// CalculateMonthEnds calculates the hierarchy at every month end from the month of from through the month of to,
+// handing each snapshot to visit in date order. Each month is seeded with the previous month's chains.
+func (h ParentHistory) CalculateMonthEnds(from time.Time, to time.Time, chars []string,
+	visit func(time.Time, *Snapshot) error) error {
+	var previous *Snapshot
+	for _, date := range MonthEnds(from, to) {
+		snapshot := h.CalculateAsOf(date, chars, previous)
+		if err := visit(date, snapshot); err != nil {
+			return err
+		}
+		previous = snapshot
+	}
+	return nil
+}
+
+// ReadParentHistoryCSV reads a parent history from CSV with an id, parent_id, valid_from, valid_to header. An empty
+// parent_id is a root and an empty valid_to is still in effect, dates use HistoryDateLayout.
+func ReadParentHistoryCSV(r io.Reader) (ParentHistory, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"id", "parent_id", "valid_from", "valid_to"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("parent history is missing the %s column", name)
+		}
+	}
+
+	history := ParentHistory{}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.ParseUint(row[columns["id"]], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid id: %v", line, err)
+		}
+		period := ParentPeriod{ParentID: Uint32Max}
+		if v := row[columns["parent_id"]]; v != "" {
+			parentID, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid parent_id: %v", line, err)
+			}
+			period.ParentID = uint32(parentID)
+		}
+		if period.From, err = time.Parse(HistoryDateLayout, row[columns["valid_from"]]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid valid_from: %v", line, err)
+		}
+		if v := row[columns["valid_to"]]; v != "" {
+			if period.To, err = time.Parse(HistoryDateLayout, v); err != nil {
+				return nil, fmt.Errorf("line %d: invalid valid_to: %v", line, err)
+			}
+		}
+		history.Add(uint32(id), period)
+	}
+	for _, periods := range history {
+		sort.Slice(periods, func(i, j int) bool { return periods[i].From.Before(periods[j].From) })
+	}
+	return history, nil
+}
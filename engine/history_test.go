@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateMonthEnds(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	history, err := ReadParentHistoryCSV(strings.NewReader(`id,parent_id,valid_from,valid_to
+1,,2020-01-01,
+2,1,2020-01-01,
+3,1,2020-01-01,2020-02-15
+3,2,2020-02-15,
+4,1,2020-03-10,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := history.ParentAsOf(3, time.Date(2020, 2, 14, 0, 0, 0, 0, time.UTC)); !ok || p != 1 {
+		t.Errorf("Expected 3 under 1 before the move, instead held %d %v", p, ok)
+	}
+	if p, ok := history.ParentAsOf(3, time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC)); !ok || p != 2 {
+		t.Errorf("Expected 3 under 2 from the move, instead held %d %v", p, ok)
+	}
+	if _, ok := history.ParentAsOf(4, time.Date(2020, 3, 9, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("Expected 4 to not exist before it joined")
+	}
+
+	type expectation struct {
+		id       uint32
+		branchID string
+		depth    int
+	}
+	expected := [][]expectation{
+		{{1, "a", 1}, {2, "aa", 2}, {3, "ab", 2}},
+		{{1, "a", 1}, {2, "aa", 2}, {3, "aaa", 3}},
+		{{1, "a", 1}, {2, "aa", 2}, {3, "aaa", 3}, {4, "ab", 2}},
+	}
+	var dates []time.Time
+	from := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)
+	err = history.CalculateMonthEnds(from, to, chars, func(date time.Time, s *Snapshot) error {
+		month := len(dates)
+		dates = append(dates, date)
+		if s.Len() != len(expected[month]) {
+			t.Errorf("Expected %d records on %v, instead held %d", len(expected[month]), date, s.Len())
+		}
+		for _, e := range expected[month] {
+			r, ok := s.Record(e.id)
+			if !ok {
+				t.Errorf("Expected %d on %v", e.id, date)
+				continue
+			}
+			verifyBranchID(t, e.branchID, r.BranchID)
+			if r.Depth != e.depth {
+				t.Errorf("Expected %d at depth %d on %v, instead held %d", e.id, e.depth, date, r.Depth)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dates) != 3 || dates[1].Day() != 29 || dates[2].Day() != 31 {
+		t.Errorf("Unexpected month ends %v", dates)
+	}
+
+	if _, err := ReadParentHistoryCSV(strings.NewReader("id,parent_id,valid_from\n")); err == nil {
+		t.Errorf("Expected an error for a missing column")
+	}
+}
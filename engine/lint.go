@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Issues the alphabet linter reports for a character
+const (
+	// LintInvalid is an entry that isn't exactly one valid character
+	LintInvalid = "invalid"
+	// LintNotNFC is a character Unicode normalization (NFC) rewrites
+	LintNotNFC = "not_nfc"
+	// LintNotNFKC is a compatibility character NFKC rewrites, like full width letters and ligatures
+	LintNotNFKC = "not_nfkc"
+	// LintCombining is a character that combines with the character before it
+	LintCombining = "combining"
+	// LintBidi is a right-to-left, Arabic number, separator or directional formatting character that reorders text
+	LintBidi = "bidi"
+	// LintWhitespace is a character that renders as blank space or gets trimmed
+	LintWhitespace = "whitespace"
+	// LintControl is a control, format, surrogate, private use or unassigned character
+	LintControl = "control"
+	// LintConfusable is a character that looks the same as an earlier character
+	LintConfusable = "confusable"
+	// LintDuplicate is a character already listed earlier
+	LintDuplicate = "duplicate"
+)
+
+// blankRunes are letters and symbols that render as blank space without being whitespace
+var blankRunes = map[rune]void{
+	0x115F: emptyVal, 0x1160: emptyVal, 0x180E: emptyVal, 0x2800: emptyVal, 0x3164: emptyVal, 0xFFA0: emptyVal,
+}
+
+// lookalikes maps letters of other scripts to the Latin letter or digit they're drawn the same as
+var lookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'һ': 'h',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S', 'Ԛ': 'Q', 'Ԝ': 'W', 'Ӏ': 'I',
+	// Greek
+	'ο': 'o', 'ν': 'v', 'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N',
+	'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin and common lookalikes
+	'ı': 'i', 'ǀ': 'l', '|': 'l', 'I': 'l', '1': 'l', 'O': '0', 'ℓ': 'l', 'Ɩ': 'l',
+}
+
+// CharLint is the classification of a single candidate character, Similar is the earlier character a duplicate or
+// confusable character matches
+type CharLint struct {
+	Index   int
+	Char    string
+	Issues  []string
+	Similar string
+}
+
+// Safe reports whether the character had no issues
+func (l CharLint) Safe() bool {
+	return len(l.Issues) == 0
+}
+
+// skeleton is what a character looks like for confusable detection
+func skeleton(char string) string {
+	s := []rune(norm.NFKC.String(char))
+	for i, r := range s {
+		if l, ok := lookalikes[r]; ok {
+			s[i] = l
+		}
+	}
+	return string(s)
+}
+
+// isPrintableASCII reports whether the character is a printable ASCII character other than space
+func isPrintableASCII(char string) bool {
+	return len(char) == 1 && char[0] > ' ' && char[0] <= '~'
+}
+
+// LintChars classifies every candidate character of an alphabet in order. Printable ASCII characters are never
+// confusable, alphabets like the ascii and alphanumeric profiles hold 1, I, l and | on purpose, but other characters
+// drawn like them are whatever their position.
+func LintChars(chars []string) []CharLint {
+	lints := make([]CharLint, len(chars))
+	seen := make(map[string]string, len(chars))
+	looks := make(map[string]string, len(chars))
+	for _, c := range chars {
+		if isPrintableASCII(c) {
+			for _, look := range []string{c, skeleton(c)} {
+				if _, ok := looks[look]; !ok {
+					looks[look] = c
+				}
+			}
+		}
+	}
+	for i, c := range chars {
+		lints[i] = CharLint{Index: i, Char: c}
+		r, size := utf8.DecodeRuneInString(c)
+		if c == "" || size != len(c) || r == utf8.RuneError {
+			lints[i].Issues = []string{LintInvalid}
+			continue
+		}
+		if first, ok := seen[c]; ok {
+			lints[i].Issues = append(lints[i].Issues, LintDuplicate)
+			lints[i].Similar = first
+		} else {
+			seen[c] = c
+			look := skeleton(c)
+			if first, ok := looks[look]; ok && !isPrintableASCII(c) {
+				lints[i].Issues = append(lints[i].Issues, LintConfusable)
+				lints[i].Similar = first
+			} else if !ok {
+				looks[look] = c
+			}
+		}
+		lints[i].Issues = append(lints[i].Issues, classifyRune(r)...)
+	}
+	return lints
+}
+
+// classifyRune lists the issues of a single character on its own
+func classifyRune(r rune) []string {
+	var issues []string
+	c := string(r)
+	if norm.NFC.String(c) != c {
+		issues = append(issues, LintNotNFC)
+	}
+	if norm.NFKC.String(c) != c {
+		issues = append(issues, LintNotNFKC)
+	}
+	props := norm.NFC.PropertiesString(c)
+	if props.CCC() != 0 || !props.BoundaryBefore() || unicode.In(r, unicode.M) {
+		issues = append(issues, LintCombining)
+	}
+	p, _ := bidi.LookupRune(r)
+	switch p.Class() {
+	case bidi.R, bidi.AL, bidi.AN, bidi.B, bidi.S, bidi.BN,
+		bidi.LRO, bidi.RLO, bidi.LRE, bidi.RLE, bidi.PDF, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		issues = append(issues, LintBidi)
+	}
+	if _, blank := blankRunes[r]; blank || unicode.IsSpace(r) || unicode.In(r, unicode.Z) {
+		issues = append(issues, LintWhitespace)
+	}
+	if unicode.In(r, unicode.Cc, unicode.Cf, unicode.Cs, unicode.Co) || !isAssigned(r) {
+		issues = append(issues, LintControl)
+	}
+	return issues
+}
+
+// isAssigned reports whether the character has a general category in the Unicode tables
+func isAssigned(r rune) bool {
+	for _, table := range unicode.Categories {
+		if unicode.Is(table, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// SafeChars keeps the characters of an alphabet the linter found no issues with, in their original order
+func SafeChars(chars []string) []string {
+	safe := make([]string, 0, len(chars))
+	for _, l := range LintChars(chars) {
+		if l.Safe() {
+			safe = append(safe, l.Char)
+		}
+	}
+	return safe
+}
+
+// CheckAlphabet returns an error summarizing the risky characters of an alphabet, nil when there are none
+func CheckAlphabet(chars []string) error {
+	counts := make(map[string]int)
+	risky := 0
+	for _, l := range LintChars(chars) {
+		if l.Safe() {
+			continue
+		}
+		risky++
+		for _, issue := range l.Issues {
+			counts[issue]++
+		}
+	}
+	if risky == 0 {
+		return nil
+	}
+	issues := make([]string, 0, len(counts))
+	for issue, n := range counts {
+		issues = append(issues, fmt.Sprintf("%s %d", issue, n))
+	}
+	sort.Strings(issues)
+	return fmt.Errorf("alphabet has %d risky characters of %d: %s", risky, len(chars), strings.Join(issues, ", "))
+}
+
+// WriteAlphabetLintCSV writes the classification of every character as a CSV row
+func WriteAlphabetLintCSV(w io.Writer, lints []CharLint) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "char", "code_point", "issues", "similar_to"}); err != nil {
+		return err
+	}
+	for _, l := range lints {
+		codePoint := ""
+		if r, size := utf8.DecodeRuneInString(l.Char); size > 0 && r != utf8.RuneError {
+			codePoint = fmt.Sprintf("U+%04X", r)
+		}
+		err := cw.Write([]string{fmt.Sprint(l.Index), l.Char, codePoint, strings.Join(l.Issues, ";"), l.Similar})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLintChars(t *testing.T) {
+	candidates := []string{"a", "é", "é", "́", "ﬁ", "Ａ", "א", "‏", " ", "ㅤ", "\u0007",
+		"", "а", "a", "ab", "", "1", "l"}
+	expected := [][]string{
+		nil,
+		nil,
+		{LintInvalid},
+		{LintCombining},
+		{LintNotNFKC},
+		{LintNotNFKC},
+		{LintBidi},
+		{LintBidi, LintControl},
+		{LintWhitespace},
+		{LintNotNFKC, LintWhitespace},
+		{LintBidi, LintControl},
+		{LintControl},
+		{LintConfusable},
+		{LintDuplicate},
+		{LintInvalid},
+		{LintInvalid},
+		nil,
+		nil,
+	}
+	lints := LintChars(candidates)
+	for i, l := range lints {
+		if strings.Join(l.Issues, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("Expected %q to have %v, instead held %v", l.Char, expected[i], l.Issues)
+		}
+	}
+	verifyBranchID(t, "a", lints[12].Similar)
+
+	verifyBranchID(t, "aé1l", strings.Join(SafeChars(candidates), ""))
+	if err := CheckAlphabet(SafeChars(candidates)); err != nil {
+		t.Errorf("Expected the safe alphabet to pass, instead held %v", err)
+	}
+	err := CheckAlphabet(candidates)
+	if err == nil || !strings.Contains(err.Error(), "14 risky characters of 18") {
+		t.Errorf("Expected the candidates to fail, instead held %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteAlphabetLintCSV(&out, lints[3:4]); err != nil {
+		t.Fatal(err)
+	}
+	verifyBranchID(t, "index,char,code_point,issues,similar_to\n3,́,U+0301,combining,\n", out.String())
+}
+
+func TestLintCharsPrintableASCII(t *testing.T) {
+	var ascii []string
+	for r := '!'; r <= '~'; r++ {
+		ascii = append(ascii, string(r))
+	}
+	if err := CheckAlphabet(ascii); err != nil {
+		t.Errorf("Expected the printable ASCII characters to pass, instead held %v", err)
+	}
+
+	// Lookalikes are confusable even when listed before the ASCII character they're drawn like
+	lints := LintChars([]string{"ǀ", "І", "0", "l", "I", "O"})
+	for i, similar := range []string{"l", "I", "", "", "", ""} {
+		confusable := similar != ""
+		if (strings.Join(lints[i].Issues, ",") == LintConfusable) != confusable || lints[i].Similar != similar {
+			t.Errorf("Expected %q to be confusable %v with %q, instead held %v %q", lints[i].Char, confusable,
+				similar, lints[i].Issues, lints[i].Similar)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+// MigratedBranchID reports a record whose branch ID changed while migrating alphabets, NewBranchID is empty when the
+// old branch ID held characters outside of the old alphabet and was burned
+type MigratedBranchID struct {
+	ID          uint32
+	OldBranchID string
+	NewBranchID string
+}
+
+// MigrateChars switches the group to a new alphabet of the same size, translating every member's branch ID character
+// by character from the current alphabet to the character at the same position in the new one. Codes keep their width
+// and relative order so the tree and sibling order are preserved and the next calculation keeps them.
+// Changed records are returned ordered by ID.
+func (group *Group) MigrateChars(newChars []string) ([]MigratedBranchID, error) {
+	if len(newChars) != len(group.chars) {
+		return nil, errors.New("new alphabet must be the same size as the current alphabet")
+	}
+	translation := make(map[rune]string, len(group.chars))
+	seen := make(map[string]void, len(newChars))
+	for i, c := range group.chars {
+		if _, dup := seen[newChars[i]]; dup {
+			return nil, errors.New("new alphabet repeats the character " + newChars[i])
+		}
+		seen[newChars[i]] = emptyVal
+		translation[[]rune(c)[0]] = newChars[i]
+	}
+
+	var migrated []MigratedBranchID
+	for _, id := range group.sortedIDs() {
+		r := group.Members[id]
+		oldBranchID := r.GetBranchID()
+		if len(oldBranchID) == 0 {
+			continue
+		}
+		var b strings.Builder
+		for _, c := range oldBranchID {
+			newChar, ok := translation[c]
+			if !ok {
+				b.Reset()
+				break
+			}
+			b.WriteString(newChar)
+		}
+		if b.String() != oldBranchID {
+			r.SetBranchID(b.String())
+			group.Members[id] = r
+			migrated = append(migrated, MigratedBranchID{ID: id, OldBranchID: oldBranchID, NewBranchID: b.String()})
+		}
+	}
+	group.SetChars(newChars)
+	return migrated, nil
+}
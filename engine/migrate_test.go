@@ -0,0 +1,56 @@
+package engine
+
+import "testing"
+
+func TestMigrateChars(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, Uint32Max, "", ""},
+		{3, 1, "", ""},
+		{4, 1, "", ""},
+		{5, 3, "", ""},
+	}
+	data := verifyHierarchy(t, dataTable)
+	data.Members[2].SetBranchID("bᶂ")
+
+	// Retire "b" in favor of "+"
+	newChars := make([]string, len(chars))
+	copy(newChars, chars)
+	newChars[1] = "+"
+
+	migrated, err := data.MigrateChars(newChars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MigratedBranchID{
+		{2, "bᶂ", ""},
+		{4, "ab", "a+"},
+	}
+	if len(migrated) != len(expected) {
+		t.Fatalf("Expected %v migrated records, instead held %+v", len(expected), migrated)
+	}
+	for i := range expected {
+		if migrated[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], migrated[i])
+		}
+	}
+
+	// Recalculating with the new alphabet keeps every migrated code
+	branchIDs := make(map[uint32]string)
+	for id, r := range data.Members {
+		branchIDs[id] = r.GetBranchID()
+	}
+	data.CalculateHierarchy()
+	for id, r := range data.Members {
+		if id != 2 && branchIDs[id] != r.GetBranchID() {
+			t.Errorf("Expected %v to keep '%v', instead held '%v'", id, branchIDs[id], r.GetBranchID())
+		}
+	}
+
+	if _, err := data.MigrateChars(chars[1:]); err == nil {
+		t.Errorf("Expected an error migrating to a smaller alphabet")
+	}
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// MultiRecord is a record taking part in several named parent hierarchies, each surfaced to the engine as its own
+// Record. The views of different hierarchies must not share mutable state so they can be calculated concurrently.
+type MultiRecord interface {
+	GetID() uint32
+	GetHierarchy(name string) Record
+}
+
+// NewHierarchyGroups builds a Group per named hierarchy from the members' views of that hierarchy
+func NewHierarchyGroups(members map[uint32]MultiRecord, names []string, chars []string) map[string]*Group {
+	groups := make(map[string]*Group, len(names))
+	for _, name := range names {
+		group := &Group{Members: make(map[uint32]Record, len(members))}
+		group.SetChars(chars)
+		for id, v := range members {
+			group.Members[id] = v.GetHierarchy(name)
+		}
+		groups[name] = group
+	}
+	return groups
+}
+
+// CalculateHierarchies calculates every named hierarchy of the members concurrently and returns the calculated
+// Group of each one
+func CalculateHierarchies(members map[uint32]MultiRecord, names []string, chars []string) map[string]*Group {
+	groups := NewHierarchyGroups(members, names, chars)
+	CalculateGroups(groups)
+	return groups
+}
+
+// CalculateGroups calculates the hierarchies of groups built by NewHierarchyGroups concurrently
+func CalculateGroups(groups map[string]*Group) {
+	defer TimeTrack(time.Now(), "Calculate all hierarchies")
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group *Group) {
+			defer wg.Done()
+			group.CalculateHierarchy()
+		}(group)
+	}
+	wg.Wait()
+}
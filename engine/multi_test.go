@@ -0,0 +1,54 @@
+package engine
+
+import "testing"
+
+type multiRecord struct {
+	id          uint32
+	hierarchies map[string]*record
+}
+
+func (r *multiRecord) GetID() uint32 {
+	return r.id
+}
+func (r *multiRecord) GetHierarchy(name string) Record {
+	return r.hierarchies[name]
+}
+
+func TestCalculateHierarchies(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	// id, sponsor, enroller
+	dataTable := [][3]uint32{
+		{1, Uint32Max, Uint32Max},
+		{2, 1, Uint32Max},
+		{3, 1, 2},
+		{4, 3, 2},
+		{5, 4, 1},
+	}
+	members := make(map[uint32]MultiRecord)
+	for _, tt := range dataTable {
+		members[tt[0]] = &multiRecord{id: tt[0], hierarchies: map[string]*record{
+			"sponsor":  {id: tt[0], parentID: tt[1]},
+			"enroller": {id: tt[0], parentID: tt[2]},
+		}}
+	}
+
+	groups := NewHierarchyGroups(members, []string{"sponsor", "enroller"}, chars)
+	for _, g := range groups {
+		g.SetIDOrder(true)
+	}
+	CalculateGroups(groups)
+
+	expected := map[string]map[uint32]string{
+		"sponsor":  {1: "a", 2: "aa", 3: "ab", 4: "aba", 5: "abaa"},
+		"enroller": {1: "a", 2: "b", 3: "ba", 4: "bb", 5: "aa"},
+	}
+	for name, branchIDs := range expected {
+		for id, branchID := range branchIDs {
+			verifyBranchID(t, branchID, members[id].GetHierarchy(name).GetBranchID())
+			verifyBranchID(t, branchID, groups[name].Members[id].GetBranchID())
+		}
+	}
+	assertBoolean(t, true, members[5].GetHierarchy("enroller").(*record).branchDepth == 2)
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Snapshot files start with a magic value and format version, followed by the alphabet fingerprint length and bytes,
+// the record count and the records ordered by ID, and end with a CRC-32 of everything before it. Version 1 files have
+// no alphabet fingerprint and are still read.
+//
+//	record: ID delta from the previous record, parent ID + 1 (0 for none), depth, branch ID length, branch ID bytes
+//
+// every number is an unsigned varint except the trailing checksum which is 4 bytes little endian
+const (
+	snapshotMagic   = "HCES"
+	snapshotVersion = uint64(2)
+	// maxStoredBranchIDLength bounds the branch IDs read back from files, in bytes. It's far longer than any chain
+	// field holds and keeps a corrupt length from allocating before the checksum is checked.
+	maxStoredBranchIDLength = 64 * 1024
+)
+
+var (
+	// ErrSnapshotFormat is returned when a file isn't a snapshot or uses an unsupported version
+	ErrSnapshotFormat = errors.New("not a supported hierarchy snapshot")
+	// ErrSnapshotChecksum is returned when a snapshot's contents don't match its checksum
+	ErrSnapshotChecksum = errors.New("hierarchy snapshot checksum mismatch")
+)
+
+// snapshotWriter tracks the checksum and the first error while writing a snapshot
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (sw *snapshotWriter) write(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc.Write(b)
+	n, err := sw.w.Write(b)
+	sw.n += int64(n)
+	sw.err = err
+}
+
+func (sw *snapshotWriter) uvarint(v uint64) {
+	sw.write(sw.buf[:binary.PutUvarint(sw.buf[:], v)])
+}
+
+// WriteTo writes the snapshot in the versioned binary format
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.NewIEEE()}
+	sw.write([]byte(snapshotMagic))
+	sw.uvarint(snapshotVersion)
+	sw.uvarint(uint64(len(s.alphabet)))
+	sw.write([]byte(s.alphabet))
+	sw.uvarint(uint64(len(s.group.Members)))
+	previousID := uint32(0)
+	for _, id := range s.group.sortedIDs() {
+		r := s.group.Members[id].(*frozenRecord)
+		sw.uvarint(uint64(id - previousID))
+		previousID = id
+		// Shifting by one maps Uint32Max, no parent, to 0
+		sw.uvarint(uint64(r.ParentID + 1))
+		sw.uvarint(uint64(r.Depth))
+		sw.uvarint(uint64(len(r.BranchID)))
+		sw.write([]byte(r.BranchID))
+	}
+	if sw.err != nil {
+		return sw.n, sw.err
+	}
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, sw.crc.Sum32())
+	n, err := sw.w.Write(checksum)
+	sw.n += int64(n)
+	if err != nil {
+		return sw.n, err
+	}
+	return sw.n, sw.w.Flush()
+}
+
+// checksumReader hashes exactly the bytes consumed from the underlying reader
+type checksumReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *checksumReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+// ReadSnapshot loads a snapshot written by Snapshot.WriteTo, validating its version and checksum
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	cr := &checksumReader{r: br, crc: crc32.NewIEEE()}
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(cr, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, ErrSnapshotFormat
+	}
+	version, err := binary.ReadUvarint(cr)
+	if err != nil || version < 1 || version > snapshotVersion {
+		return nil, ErrSnapshotFormat
+	}
+	var alphabet []byte
+	if version >= 2 {
+		size, err := binary.ReadUvarint(cr)
+		if err != nil || size > maxFingerprintLength {
+			return nil, ErrSnapshotFormat
+		}
+		alphabet = make([]byte, size)
+		if _, err := io.ReadFull(cr, alphabet); err != nil {
+			return nil, err
+		}
+	}
+	count, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &Group{Members: make(map[uint32]Record)}
+	id := uint32(0)
+	values := make([]uint64, 4)
+	for i := uint64(0); i < count; i++ {
+		for j := range values {
+			if values[j], err = binary.ReadUvarint(cr); err != nil {
+				return nil, fmt.Errorf("reading record %d: %v", i, err)
+			}
+		}
+		if values[3] > maxStoredBranchIDLength {
+			return nil, ErrSnapshotFormat
+		}
+		branchID := make([]byte, values[3])
+		if _, err := io.ReadFull(cr, branchID); err != nil {
+			return nil, fmt.Errorf("reading record %d: %v", i, err)
+		}
+		id += uint32(values[0])
+		group.Members[id] = &frozenRecord{SnapshotRecord{
+			ID:       id,
+			ParentID: uint32(values[1]) - 1,
+			Depth:    int(values[2]),
+			BranchID: string(branchID),
+		}}
+	}
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(br, checksum); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(checksum) != cr.crc.Sum32() {
+		return nil, ErrSnapshotChecksum
+	}
+
+	for _, v := range group.Members {
+		if p, ok := group.Members[v.GetParentID()]; ok {
+			p.(*frozenRecord).Children = append(p.(*frozenRecord).Children, v.GetID())
+		}
+	}
+	for _, v := range group.Members {
+		sortIDs(v.(*frozenRecord).Children)
+	}
+	return &Snapshot{group: group, query: NewQuery(group), alphabet: string(alphabet)}, nil
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{40000, 3, "", ""},
+		{5, 40000, "", ""},
+		{6, 99, "늌", ""},
+	}
+	data := verifyHierarchy(t, dataTable)
+	original := data.Snapshot()
+
+	var b bytes.Buffer
+	if _, err := original.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	encoded := b.Bytes()
+	loaded, err := ReadSnapshot(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != original.Len() {
+		t.Errorf("Expected %v records, instead held %v", original.Len(), loaded.Len())
+	}
+	for _, tt := range dataTable {
+		expected, _ := original.Record(tt.ID)
+		actual, ok := loaded.Record(tt.ID)
+		if !ok || expected.ParentID != actual.ParentID || expected.BranchID != actual.BranchID ||
+			expected.Depth != actual.Depth || len(expected.Children) != len(actual.Children) {
+			t.Errorf("Expected %+v, instead held %+v", expected, actual)
+		}
+	}
+	assertBoolean(t, true, loaded.Query().IsAncestor(1, 5))
+	if loaded.AlphabetFingerprint() != AlphabetFingerprint(chars) {
+		t.Errorf("Expected alphabet %v, instead held %v", AlphabetFingerprint(chars), loaded.AlphabetFingerprint())
+	}
+
+	// Flip a bit in a branch ID
+	corrupted := append([]byte{}, encoded...)
+	corrupted[len(corrupted)-6] ^= 1
+	if _, err := ReadSnapshot(bytes.NewReader(corrupted)); err != ErrSnapshotChecksum {
+		t.Errorf("Expected a checksum error, instead held %v", err)
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte("HCES\x09"))); err != ErrSnapshotFormat {
+		t.Errorf("Expected a format error, instead held %v", err)
+	}
+	// A corrupt branch ID length is rejected before anything is allocated for it
+	corruptLength := []byte("HCES\x01\x01\x00\x00\x01\xff\xff\xff\xff\xff\xff\xff\xff\x7f")
+	if _, err := ReadSnapshot(bytes.NewReader(corruptLength)); err != ErrSnapshotFormat {
+		t.Errorf("Expected a format error, instead held %v", err)
+	}
+
+	// An empty version 1 snapshot has no alphabet
+	v1 := []byte("HCES\x01\x00")
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(v1))
+	loaded, err = ReadSnapshot(bytes.NewReader(append(v1, checksum...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 0 || loaded.AlphabetFingerprint() != "" {
+		t.Errorf("Expected an empty snapshot without an alphabet, instead held %v records and %q", loaded.Len(),
+			loaded.AlphabetFingerprint())
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Query answers ancestor and descendant questions about a computed Group using its branch IDs. Every child's branch ID
+// extends its parent's with a fixed width code per sibling group, so a record is an ancestor of another exactly when its
+// branch ID is a proper prefix of the other's. Branch IDs are indexed in sorted order, which keeps each downline in a
+// contiguous range. A Query reflects the Group at the time it was built, build a new one after recalculating.
+type Query struct {
+	group     *Group
+	branchIDs []string
+	ids       []uint32
+	depths    []uint8
+}
+
+// NewQuery indexes the branch IDs of a computed Group, records without a branch ID are left out
+func NewQuery(group *Group) *Query {
+	q := &Query{group: group}
+	q.branchIDs = make([]string, 0, len(group.Members))
+	for _, v := range group.Members {
+		if len(v.GetBranchID()) > 0 {
+			q.branchIDs = append(q.branchIDs, v.GetBranchID())
+		}
+	}
+	sort.Strings(q.branchIDs)
+
+	ids := make(map[string]uint32, len(q.branchIDs))
+	for _, v := range group.Members {
+		if len(v.GetBranchID()) > 0 {
+			ids[v.GetBranchID()] = v.GetID()
+		}
+	}
+	q.ids = make([]uint32, len(q.branchIDs))
+	q.depths = make([]uint8, len(q.branchIDs))
+	// Walk in sorted order keeping the chain of ancestors of the current entry to find each depth
+	var stack []string
+	for i, b := range q.branchIDs {
+		q.ids[i] = ids[b]
+		for len(stack) > 0 && !strings.HasPrefix(b, stack[len(stack)-1]) {
+			stack = stack[:len(stack)-1]
+		}
+		q.depths[i] = uint8(len(stack) + 1)
+		stack = append(stack, b)
+	}
+	return q
+}
+
+// position finds the index of a branch ID in the sorted index
+func (q *Query) position(branchID string) (int, bool) {
+	if len(branchID) == 0 {
+		return 0, false
+	}
+	i := sort.SearchStrings(q.branchIDs, branchID)
+	return i, i < len(q.branchIDs) && q.branchIDs[i] == branchID
+}
+
+// positionOf finds the index of a record in the sorted index
+func (q *Query) positionOf(id uint32) (int, bool) {
+	r, ok := q.group.Members[id]
+	if !ok {
+		return 0, false
+	}
+	return q.position(r.GetBranchID())
+}
+
+// IsAncestor reports whether ancestorID is somewhere in the upline of descendantID
+func (q *Query) IsAncestor(ancestorID uint32, descendantID uint32) bool {
+	a, ok := q.positionOf(ancestorID)
+	if !ok {
+		return false
+	}
+	d, ok := q.positionOf(descendantID)
+	if !ok {
+		return false
+	}
+	return a != d && strings.HasPrefix(q.branchIDs[d], q.branchIDs[a])
+}
+
+// Depth returns the level of a record in its tree, roots are at depth 1
+func (q *Query) Depth(id uint32) (int, bool) {
+	p, ok := q.positionOf(id)
+	if !ok {
+		return 0, false
+	}
+	return int(q.depths[p]), true
+}
+
+// Ancestors returns the IDs of a record's ancestors ordered from the root down to the direct parent
+func (q *Query) Ancestors(id uint32) []uint32 {
+	p, ok := q.positionOf(id)
+	if !ok {
+		return nil
+	}
+	return q.prefixRecords(q.branchIDs[p][:len(q.branchIDs[p])-lastRuneLen(q.branchIDs[p])])
+}
+
+// LowestCommonAncestor returns the deepest record that is an ancestor of, or the same as, both records
+func (q *Query) LowestCommonAncestor(a uint32, b uint32) (uint32, bool) {
+	pa, ok := q.positionOf(a)
+	if !ok {
+		return 0, false
+	}
+	pb, ok := q.positionOf(b)
+	if !ok {
+		return 0, false
+	}
+	common := commonRunePrefix(q.branchIDs[pa], q.branchIDs[pb])
+	ancestors := q.prefixRecords(common)
+	if len(ancestors) == 0 {
+		return 0, false
+	}
+	return ancestors[len(ancestors)-1], true
+}
+
+// Descendants returns the IDs of a record's downline in branch ID order, limited to maxDepth levels below the
+// record when maxDepth is above 0
+func (q *Query) Descendants(id uint32, maxDepth int) []uint32 {
+	p, ok := q.positionOf(id)
+	if !ok {
+		return nil
+	}
+	end := q.downlineEnd(p)
+	descendants := make([]uint32, 0, end-p-1)
+	for i := p + 1; i < end; i++ {
+		if maxDepth > 0 && int(q.depths[i])-int(q.depths[p]) > maxDepth {
+			continue
+		}
+		descendants = append(descendants, q.ids[i])
+	}
+	return descendants
+}
+
+// DescendantCount returns the size of a record's downline without listing it
+func (q *Query) DescendantCount(id uint32) int {
+	p, ok := q.positionOf(id)
+	if !ok {
+		return 0
+	}
+	return q.downlineEnd(p) - p - 1
+}
+
+// downlineEnd finds the index just past the downline of the record at a position, everything sharing its branch ID
+// as a prefix sorts directly after the record itself
+func (q *Query) downlineEnd(p int) int {
+	branchID := q.branchIDs[p]
+	return p + 1 + sort.Search(len(q.branchIDs)-p-1, func(i int) bool {
+		return !strings.HasPrefix(q.branchIDs[p+1+i], branchID)
+	})
+}
+
+// prefixRecords returns the records whose branch ID is a prefix of, or equal to, the given value ordered shortest first
+func (q *Query) prefixRecords(branchID string) []uint32 {
+	var ids []uint32
+	for i := range branchID {
+		_, size := utf8.DecodeRuneInString(branchID[i:])
+		if p, ok := q.position(branchID[:i+size]); ok {
+			ids = append(ids, q.ids[p])
+		}
+	}
+	return ids
+}
+
+func lastRuneLen(s string) int {
+	_, size := utf8.DecodeLastRuneInString(s)
+	return size
+}
+
+// commonRunePrefix returns the longest prefix shared by both values without splitting a character
+func commonRunePrefix(a string, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) {
+		ra, size := utf8.DecodeRuneInString(a[i:])
+		rb, _ := utf8.DecodeRuneInString(b[i:])
+		if ra != rb {
+			break
+		}
+		i += size
+	}
+	return a[:i]
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+	recordCount := 5000
+
+	dataTable := make([]dataSeed, recordCount)
+	for i := 0; i < recordCount; i++ {
+		parentID := Uint32Max
+		if i > 0 {
+			parentID = uint32(math.Mod(rand.Float64()*float64(recordCount), float64(i)))
+		}
+		dataTable[i] = dataSeed{ID: uint32(i), parentID: parentID}
+	}
+	data := verifyHierarchy(t, dataTable)
+	q := NewQuery(&data)
+
+	// Work out the expected answers by walking parents
+	upline := func(id uint32) []uint32 {
+		var ids []uint32
+		for p := data.Members[id].GetParentID(); p != Uint32Max; p = data.Members[p].GetParentID() {
+			ids = append([]uint32{p}, ids...)
+		}
+		return ids
+	}
+
+	for i := 0; i < 200; i++ {
+		a := uint32(rand.Intn(recordCount))
+		b := uint32(rand.Intn(recordCount))
+		aUpline := upline(a)
+		bUpline := upline(b)
+		assertUint32s(t, aUpline, q.Ancestors(a))
+
+		isAncestor := false
+		for _, id := range bUpline {
+			if id == a {
+				isAncestor = true
+			}
+		}
+		assertBoolean(t, isAncestor, q.IsAncestor(a, b))
+
+		aPath := append(aUpline, a)
+		bPath := append(bUpline, b)
+		lca, found := q.LowestCommonAncestor(a, b)
+		assertBoolean(t, aPath[0] == bPath[0], found)
+		if found {
+			expected := aPath[0]
+			for j := 0; j < len(aPath) && j < len(bPath) && aPath[j] == bPath[j]; j++ {
+				expected = aPath[j]
+			}
+			if lca != expected {
+				t.Errorf("Expected lowest common ancestor of %v and %v to be %v, instead held %v", a, b, expected, lca)
+			}
+		}
+	}
+
+	// Root 0 holds every record, its direct children are the first level
+	if len(q.Descendants(0, 0)) != recordCount-1 {
+		t.Errorf("Expected %v descendants, instead held %v", recordCount-1, len(q.Descendants(0, 0)))
+	}
+	children := make(map[uint32]bool)
+	for _, id := range data.Members[0].GetChildren() {
+		children[id] = true
+	}
+	firstLevel := q.Descendants(0, 1)
+	if len(firstLevel) != len(children) {
+		t.Errorf("Expected %v first level descendants, instead held %v", len(children), len(firstLevel))
+	}
+	for _, id := range firstLevel {
+		if !children[id] {
+			t.Errorf("Expected %v to be a direct child of 0", id)
+		}
+	}
+}
@@ -16,10 +16,17 @@ type record struct {
 	parentID          uint32
 	children          []uint32
 	branchDepth       uint8
-	isChanged         bool
+	branchIDSet       bool
 	branchID          string
+	loadedBranchID    string
 	parentBranchID    string
 	parentBranchDepth uint8
+	value             float64
+	rollup            Rollup
+	generationCounts  []uint32
+	rootID            uint32
+	ancestors         []uint32
+	levelAncestors    []uint32
 }
 
 func (r *record) GetID() uint32 {
@@ -38,7 +45,11 @@ func (r *record) GetBranchID() string {
 	return r.branchID
 }
 func (r *record) SetBranchID(branchID string) {
-	r.isChanged = true
+	// Remember the value the record was loaded with the first time it's touched
+	if !r.branchIDSet {
+		r.loadedBranchID = r.branchID
+		r.branchIDSet = true
+	}
 	r.branchID = branchID
 }
 func (r *record) GetParentBranchID() string {
@@ -48,5 +59,29 @@ func (r *record) SetBranchDepth(branchDepth uint8) {
 	r.branchDepth = branchDepth
 }
 func (r *record) GetIsChanged() bool {
-	return r.isChanged
+	return r.branchIDSet && r.branchID != r.loadedBranchID
+}
+func (r *record) GetValue() float64 {
+	return r.value
+}
+func (r *record) GetRollup() Rollup {
+	return r.rollup
+}
+func (r *record) SetRollup(rollup Rollup) {
+	r.rollup = rollup
+}
+func (r *record) GetGenerationCounts() []uint32 {
+	return r.generationCounts
+}
+func (r *record) SetGenerationCounts(counts []uint32) {
+	r.generationCounts = counts
+}
+func (r *record) SetRootID(rootID uint32) {
+	r.rootID = rootID
+}
+func (r *record) SetAncestors(ancestors []uint32) {
+	r.ancestors = ancestors
+}
+func (r *record) SetLevelAncestors(levelAncestors []uint32) {
+	r.levelAncestors = levelAncestors
 }
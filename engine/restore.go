@@ -0,0 +1,136 @@
+package engine
+
+import "unicode/utf8"
+
+// RestoreStatus describes how a record's parent was recovered from its branch ID
+type RestoreStatus string
+
+const (
+	// RestoreResolved found exactly one record holding the parent's branch ID
+	RestoreResolved RestoreStatus = "resolved"
+	// RestoreRoot is a top level branch ID, the record has no parent
+	RestoreRoot RestoreStatus = "root"
+	// RestoreUnresolvable has no record holding any prefix of the branch ID, the parent is missing
+	RestoreUnresolvable RestoreStatus = "unresolvable"
+	// RestoreMissingParent has an ancestor holding a prefix of the branch ID, but not one a single code shorter, so
+	// the direct parent's branch ID isn't on hand
+	RestoreMissingParent RestoreStatus = "missing_parent"
+	// RestoreAmbiguous shares its branch ID, or its parent's, with another record
+	RestoreAmbiguous RestoreStatus = "ambiguous"
+	// RestoreEmpty has no branch ID to work from
+	RestoreEmpty RestoreStatus = "empty"
+)
+
+// RestoredParent is the parent recovered for a single record, ParentID is Uint32Max unless the status is resolved
+type RestoredParent struct {
+	ID       uint32
+	ParentID uint32
+	Status   RestoreStatus
+}
+
+// RestoreParents rebuilds parent IDs from the members' branch IDs alone by matching each branch ID to the record
+// holding its longest proper prefix. Top level branch IDs are recognized by having the shortest width of all of them.
+// The match is only the parent when it's exactly one sibling code shorter. Siblings always share a code width, and
+// codes only widen when a sibling group outgrows the alphabet, so a match extended by a longer code than the parent's
+// other children or than its number of children needs is skipping a missing record and is reported as missing its
+// parent. Groups without an alphabet are taken to use single character codes. Results are ordered by ID.
+func (group *Group) RestoreParents() []RestoredParent {
+	owners := make(map[string]uint32, len(group.Members))
+	duplicates := make(map[string]void)
+	rootWidth := 0
+	for _, v := range group.Members {
+		branchID := v.GetBranchID()
+		if len(branchID) == 0 {
+			continue
+		}
+		if _, exists := owners[branchID]; exists {
+			duplicates[branchID] = emptyVal
+		}
+		owners[branchID] = v.GetID()
+		if width := utf8.RuneCountInString(branchID); rootWidth == 0 || width < rootWidth {
+			rootWidth = width
+		}
+	}
+
+	restored := make([]RestoredParent, 0, len(group.Members))
+	widths := make([]int, 0, len(group.Members))
+	// The narrowest code extending each matched record and how many records it matched with each code width
+	codeWidths := make(map[uint32]int)
+	matches := make(map[uint32]map[int]int)
+	for _, id := range group.sortedIDs() {
+		rp := restoreParent(id, group.Members[id].GetBranchID(), owners, duplicates, rootWidth)
+		width := 0
+		if rp.Status == RestoreResolved {
+			width = codeWidth(group.Members[id].GetBranchID(), group.Members[rp.ParentID].GetBranchID())
+			if w, ok := codeWidths[rp.ParentID]; !ok || width < w {
+				codeWidths[rp.ParentID] = width
+			}
+			if matches[rp.ParentID] == nil {
+				matches[rp.ParentID] = make(map[int]int)
+			}
+			matches[rp.ParentID][width]++
+		}
+		restored = append(restored, rp)
+		widths = append(widths, width)
+	}
+
+	for i, rp := range restored {
+		if rp.Status != RestoreResolved {
+			continue
+		}
+		if widths[i] > codeWidths[rp.ParentID] || widths[i] > group.maxCodeWidth(matches[rp.ParentID][widths[i]]) {
+			restored[i].ParentID = Uint32Max
+			restored[i].Status = RestoreMissingParent
+		}
+	}
+	return restored
+}
+
+// maxCodeWidth is the widest code a sibling group of the size can have been given
+func (group *Group) maxCodeWidth(siblings int) int {
+	if len(group.chars) < 2 {
+		return 1
+	}
+	return siblingWidth(siblings, len(group.chars))
+}
+
+// codeWidth is the number of characters a branch ID adds to its parent's
+func codeWidth(branchID string, parentBranchID string) int {
+	return utf8.RuneCountInString(branchID) - utf8.RuneCountInString(parentBranchID)
+}
+
+func restoreParent(id uint32, branchID string, owners map[string]uint32, duplicates map[string]void, rootWidth int) RestoredParent {
+	rp := RestoredParent{ID: id, ParentID: Uint32Max}
+	if len(branchID) == 0 {
+		rp.Status = RestoreEmpty
+		return rp
+	}
+	if _, dup := duplicates[branchID]; dup {
+		rp.Status = RestoreAmbiguous
+		return rp
+	}
+	// Drop a character at a time from the end looking for the closest ancestor on hand
+	prefix := branchID
+	for {
+		_, size := utf8.DecodeLastRuneInString(prefix)
+		prefix = prefix[:len(prefix)-size]
+		if len(prefix) == 0 {
+			break
+		}
+		if parentID, ok := owners[prefix]; ok {
+			if _, dup := duplicates[prefix]; dup {
+				rp.Status = RestoreAmbiguous
+				return rp
+			}
+			rp.ParentID = parentID
+			rp.Status = RestoreResolved
+			return rp
+		}
+	}
+	if utf8.RuneCountInString(branchID) == rootWidth {
+		rp.Status = RestoreRoot
+	} else {
+		rp.Status = RestoreUnresolvable
+	}
+	return rp
+}
@@ -0,0 +1,81 @@
+package engine
+
+import "testing"
+
+func TestRestoreParents(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "a", ""},
+		{2, Uint32Max, "b", ""},
+		{3, Uint32Max, "ca", ""},
+		{4, Uint32Max, "aa", ""},
+		{5, Uint32Max, "ab", ""},
+		{6, Uint32Max, "aba", ""},
+		{7, Uint32Max, "abb", ""},
+		{8, Uint32Max, "abb", ""},
+		{9, Uint32Max, "abba", ""},
+		{10, Uint32Max, "", ""},
+		{11, Uint32Max, "bcd", ""},
+		{12, Uint32Max, "ba", ""},
+		// The parent "ad" and grandparent "ada" are gone, no other record extends "a" by as much
+		{13, Uint32Max, "adab", ""},
+		// The parent "caa" is gone, the grandparent 3 has no other children
+		{14, Uint32Max, "caab", ""},
+	}
+	data := Group{Members: make(map[uint32]Record)}
+	for _, tt := range dataTable {
+		data.Members[tt.ID] = &record{id: tt.ID, parentID: tt.parentID, branchID: tt.branchID}
+	}
+
+	expected := []RestoredParent{
+		{1, Uint32Max, RestoreRoot},
+		{2, Uint32Max, RestoreRoot},
+		{3, Uint32Max, RestoreUnresolvable},
+		{4, 1, RestoreResolved},
+		{5, 1, RestoreResolved},
+		{6, 5, RestoreResolved},
+		{7, Uint32Max, RestoreAmbiguous},
+		{8, Uint32Max, RestoreAmbiguous},
+		{9, Uint32Max, RestoreAmbiguous},
+		{10, Uint32Max, RestoreEmpty},
+		{11, Uint32Max, RestoreMissingParent},
+		{12, 2, RestoreResolved},
+		{13, Uint32Max, RestoreMissingParent},
+		{14, Uint32Max, RestoreMissingParent},
+	}
+	restored := data.RestoreParents()
+	if len(restored) != len(expected) {
+		t.Fatalf("Expected %v restored parents, instead held %v", len(expected), len(restored))
+	}
+	for i := range expected {
+		if restored[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], restored[i])
+		}
+	}
+}
+
+func TestRestoreParentsWideCodes(t *testing.T) {
+	// Three siblings outgrow a two character alphabet and get two character codes
+	data := Group{Members: make(map[uint32]Record)}
+	data.SetChars([]string{"a", "b"})
+	for id, branchID := range map[uint32]string{1: "a", 2: "aaa", 3: "aab", 4: "aba", 5: "b", 6: "bab"} {
+		data.Members[id] = &record{id: id, parentID: Uint32Max, branchID: branchID}
+	}
+	expected := []RestoredParent{
+		{1, Uint32Max, RestoreRoot},
+		{2, 1, RestoreResolved},
+		{3, 1, RestoreResolved},
+		{4, 1, RestoreResolved},
+		{5, Uint32Max, RestoreRoot},
+		// A single child only needs a one character code, "ba" is missing
+		{6, Uint32Max, RestoreMissingParent},
+	}
+	restored := data.RestoreParents()
+	for i := range expected {
+		if restored[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], restored[i])
+		}
+	}
+}
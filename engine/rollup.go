@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// ValueRecord is an optional Record extension that surfaces a numeric value (volume, order total)
+// to be aggregated over the downline
+type ValueRecord interface {
+	GetValue() float64
+}
+
+// RollupRecord is an optional Record extension that holds the calculated downline rollups
+type RollupRecord interface {
+	GetRollup() Rollup
+	SetRollup(Rollup)
+}
+
+// Aggregate holds the sum, min, max and count of a set of values
+type Aggregate struct {
+	Sum   float64
+	Min   float64
+	Max   float64
+	Count uint32
+}
+
+// Rollup holds the aggregates of a record's entire downline and of its first N levels, the record's own value is not included
+type Rollup struct {
+	Downline    Aggregate
+	FirstLevels Aggregate
+}
+
+func (a *Aggregate) addValue(v float64) {
+	if a.Count == 0 || v < a.Min {
+		a.Min = v
+	}
+	if a.Count == 0 || v > a.Max {
+		a.Max = v
+	}
+	a.Sum += v
+	a.Count++
+}
+
+func (a *Aggregate) merge(b Aggregate) {
+	if b.Count == 0 {
+		return
+	}
+	if a.Count == 0 || b.Min < a.Min {
+		a.Min = b.Min
+	}
+	if a.Count == 0 || b.Max > a.Max {
+		a.Max = b.Max
+	}
+	a.Sum += b.Sum
+	a.Count += b.Count
+}
+
+// CalculateRollups aggregates the values of every record's downline bottom-up, both over the entire downline
+// and over the first levels below the record. Children must already be linked by CalculateHierarchy.
+// Records that don't implement ValueRecord contribute nothing, records that implement RollupRecord receive the result.
+// A negative number of levels is treated as 0.
+func (group *Group) CalculateRollups(levels int) {
+	if levels < 0 {
+		levels = 0
+	}
+	for _, v := range group.Members {
+		if _, ok := group.Members[v.GetParentID()]; ok {
+			continue
+		}
+		group.calculateRollup(v.GetID(), levels)
+	}
+}
+
+// calculateRollup returns the aggregate of the record's downline and the per level aggregates of its first levels
+func (group *Group) calculateRollup(id uint32, levels int) (Aggregate, []Aggregate) {
+	r := group.Members[id]
+	downline := Aggregate{}
+	byLevel := make([]Aggregate, levels)
+	for _, cID := range r.GetChildren() {
+		childDownline, childLevels := group.calculateRollup(cID, levels)
+		if vr, ok := group.Members[cID].(ValueRecord); ok {
+			downline.addValue(vr.GetValue())
+			if levels > 0 {
+				byLevel[0].addValue(vr.GetValue())
+			}
+		}
+		downline.merge(childDownline)
+		// The child's levels are one level further away from this record
+		for i := 0; i < levels-1; i++ {
+			byLevel[i+1].merge(childLevels[i])
+		}
+	}
+
+	if rr, ok := r.(RollupRecord); ok {
+		firstLevels := Aggregate{}
+		for _, a := range byLevel {
+			firstLevels.merge(a)
+		}
+		rr.SetRollup(Rollup{Downline: downline, FirstLevels: firstLevels})
+		group.Members[id] = r
+	}
+	return downline, byLevel
+}
+
+// WriteRollupsCSV writes the rollups of every record implementing RollupRecord as rows ordered by ID
+func (group *Group) WriteRollupsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"id", "downline_sum", "downline_min", "downline_max", "downline_count",
+		"first_levels_sum", "first_levels_min", "first_levels_max", "first_levels_count"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, id := range group.sortedIDs() {
+		rr, ok := group.Members[id].(RollupRecord)
+		if !ok {
+			continue
+		}
+		row := []string{strconv.FormatUint(uint64(id), 10)}
+		for _, a := range []Aggregate{rr.GetRollup().Downline, rr.GetRollup().FirstLevels} {
+			row = append(row, format(a.Sum), format(a.Min), format(a.Max), strconv.FormatUint(uint64(a.Count), 10))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
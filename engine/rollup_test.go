@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCalculateRollups(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{4, 2, "", ""},
+		{5, 4, "", ""},
+		{6, Uint32Max, "", ""},
+	}
+	values := map[uint32]float64{1: 100, 2: 10, 3: 20, 4: 5, 5: 40, 6: 7}
+
+	data := verifyHierarchy(t, dataTable)
+	for id, v := range values {
+		data.Members[id].(*record).value = v
+	}
+	data.CalculateRollups(2)
+
+	r := data.Members[1].(*record).rollup
+	assertAggregate(t, Aggregate{Sum: 75, Min: 5, Max: 40, Count: 4}, r.Downline)
+	assertAggregate(t, Aggregate{Sum: 35, Min: 5, Max: 20, Count: 3}, r.FirstLevels)
+
+	r = data.Members[2].(*record).rollup
+	assertAggregate(t, Aggregate{Sum: 45, Min: 5, Max: 40, Count: 2}, r.Downline)
+	assertAggregate(t, Aggregate{Sum: 45, Min: 5, Max: 40, Count: 2}, r.FirstLevels)
+
+	r = data.Members[6].(*record).rollup
+	assertAggregate(t, Aggregate{}, r.Downline)
+	assertAggregate(t, Aggregate{}, r.FirstLevels)
+
+	var b bytes.Buffer
+	if err := data.WriteRollupsCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	expected := "2,45,5,40,2,45,5,40,2"
+	if len(lines) < 3 || lines[2] != expected {
+		t.Errorf("Expected the row of 2 to be %v, instead held %v", expected, lines)
+	}
+
+	// Negative levels only roll up the whole downline
+	data.CalculateRollups(-1)
+	r = data.Members[1].(*record).rollup
+	assertAggregate(t, Aggregate{Sum: 75, Min: 5, Max: 40, Count: 4}, r.Downline)
+	assertAggregate(t, Aggregate{}, r.FirstLevels)
+}
+
+func assertAggregate(t *testing.T, expected Aggregate, actual Aggregate) {
+	if expected != actual {
+		t.Errorf("Expected aggregate %+v, instead held %+v", expected, actual)
+	}
+}
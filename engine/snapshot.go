@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+// SnapshotRecord is the frozen state of a single record in a Snapshot
+type SnapshotRecord struct {
+	ID       uint32
+	ParentID uint32
+	BranchID string
+	Depth    int
+	Children []uint32
+}
+
+// frozenRecord surfaces a SnapshotRecord to the engine's read paths, it is never handed to a calculation
+type frozenRecord struct {
+	SnapshotRecord
+}
+
+func (r *frozenRecord) GetID() uint32 {
+	return r.ID
+}
+func (r *frozenRecord) GetParentID() uint32 {
+	return r.ParentID
+}
+func (r *frozenRecord) GetChildren() []uint32 {
+	return r.Children
+}
+func (r *frozenRecord) SetChildren([]uint32) {
+	panic("snapshot records are read only")
+}
+func (r *frozenRecord) GetBranchID() string {
+	return r.BranchID
+}
+func (r *frozenRecord) SetBranchID(string) {
+	panic("snapshot records are read only")
+}
+func (r *frozenRecord) SetBranchDepth(uint8) {
+	panic("snapshot records are read only")
+}
+
+// Snapshot is an immutable copy of a computed hierarchy, safe to read from any number of goroutines while the Group
+// it was taken from is recalculated
+type Snapshot struct {
+	group *Group
+	query *Query
+	// alphabet is the fingerprint of the alphabet the chains were built from, empty when unknown
+	alphabet string
+}
+
+// Snapshot copies the current state of the group, it must not be taken while a calculation is running
+func (group *Group) Snapshot() *Snapshot {
+	frozen := &Group{Members: make(map[uint32]Record, len(group.Members)), idOrder: group.idOrder}
+	frozen.SetChars(group.chars)
+	for id, v := range group.Members {
+		children := make([]uint32, len(v.GetChildren()))
+		copy(children, v.GetChildren())
+		frozen.Members[id] = &frozenRecord{SnapshotRecord{
+			ID:       v.GetID(),
+			ParentID: v.GetParentID(),
+			BranchID: v.GetBranchID(),
+			Children: children,
+		}}
+	}
+	s := &Snapshot{group: frozen, query: NewQuery(frozen), alphabet: group.AlphabetFingerprint()}
+	for id, v := range frozen.Members {
+		v.(*frozenRecord).Depth, _ = s.query.Depth(id)
+	}
+	return s
+}
+
+// AlphabetFingerprint identifies the alphabet the snapshot's chains were built from, empty for snapshots read from
+// files written before fingerprints were stored
+func (s *Snapshot) AlphabetFingerprint() string {
+	return s.alphabet
+}
+
+// Len is the number of records in the snapshot
+func (s *Snapshot) Len() int {
+	return len(s.group.Members)
+}
+
+// Record returns a copy of a record's frozen state, its Children must be treated as read only
+func (s *Snapshot) Record(id uint32) (SnapshotRecord, bool) {
+	r, ok := s.group.Members[id]
+	if !ok {
+		return SnapshotRecord{}, false
+	}
+	return r.(*frozenRecord).SnapshotRecord, true
+}
+
+// Query answers ancestor and descendant questions against the snapshot
+func (s *Snapshot) Query() *Query {
+	return s.query
+}
+
+// WriteCSV writes every record of the snapshot as a CSV row ordered by ID
+func (s *Snapshot) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "parent_id", "branch_id", "depth"}); err != nil {
+		return err
+	}
+	for _, id := range s.group.sortedIDs() {
+		r := s.group.Members[id].(*frozenRecord)
+		err := cw.Write([]string{
+			strconv.FormatUint(uint64(id), 10),
+			formatParentID(r.ParentID),
+			r.BranchID,
+			strconv.Itoa(r.Depth),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Publisher hands the most recently published Snapshot to concurrent readers, readers keep the Snapshot they
+// received even after a newer one is published
+type Publisher struct {
+	current atomic.Value
+}
+
+// Publish makes a snapshot the current one
+func (p *Publisher) Publish(s *Snapshot) {
+	p.current.Store(s)
+}
+
+// Current returns the most recently published snapshot, nil until the first one is published
+func (p *Publisher) Current() *Snapshot {
+	s, _ := p.current.Load().(*Snapshot)
+	return s
+}
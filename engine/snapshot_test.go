@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotReadsDuringRecalculation(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+	recordCount := 2000
+
+	dataTable := make([]dataSeed, recordCount)
+	for i := 0; i < recordCount; i++ {
+		parentID := Uint32Max
+		if i > 0 {
+			parentID = uint32(i / 3)
+		}
+		dataTable[i] = dataSeed{ID: uint32(i), parentID: parentID}
+	}
+	data := verifyHierarchy(t, dataTable)
+
+	p := Publisher{}
+	if p.Current() != nil {
+		t.Errorf("Expected no snapshot before publishing")
+	}
+	p.Publish(data.Snapshot())
+
+	done := make(chan void)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := p.Current()
+				if s.Len() != recordCount {
+					t.Errorf("Expected %v records, instead held %v", recordCount, s.Len())
+					return
+				}
+				for id := uint32(1); id < uint32(recordCount); id += 97 {
+					r, _ := s.Record(id)
+					parent, ok := s.Record(r.ParentID)
+					if !ok || !strings.HasPrefix(r.BranchID, parent.BranchID) || r.Depth != parent.Depth+1 {
+						t.Errorf("Expected %+v to extend its parent %+v", r, parent)
+						return
+					}
+					if !s.Query().IsAncestor(r.ParentID, id) {
+						t.Errorf("Expected %v to be an ancestor of %v", r.ParentID, id)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// Keep moving records around and publishing while the readers work
+	for i := 0; i < 20; i++ {
+		for id := uint32(100 + i); id < uint32(recordCount); id += 50 {
+			data.Members[id].(*record).parentID = uint32(i)
+		}
+		data.CalculateHierarchy()
+		p.Publish(data.Snapshot())
+	}
+	close(done)
+	wg.Wait()
+}
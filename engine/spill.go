@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Spill files hold ExternalRecords back to back, each as unsigned varints of the ID, parent ID + 1 (0 for none),
+// depth, branch ID length and payload length followed by the branch ID and payload bytes. Branch IDs and payloads are
+// each limited to maxStoredBranchIDLength bytes.
+const spillBufferSize = 32 * 1024
+
+// errSpillRecordSize is returned for a record too large to spill, or a spill file whose lengths are corrupt
+var errSpillRecordSize = errors.New("spilled record is larger than the spill format allows")
+
+// recordSource hands out records one at a time, returning io.EOF once it's exhausted
+type recordSource func() (ExternalRecord, error)
+
+// recordLess orders records within a spill run
+type recordLess func(a, b *ExternalRecord) bool
+
+// byParent orders records by parent ID, then ID so sibling groups are read in the order CalculateHierarchy uses
+func byParent(a, b *ExternalRecord) bool {
+	if a.ParentID != b.ParentID {
+		return a.ParentID < b.ParentID
+	}
+	return a.ID < b.ID
+}
+
+// byID orders records by ID
+func byID(a, b *ExternalRecord) bool {
+	return a.ID < b.ID
+}
+
+// externalRecordSize estimates the memory a buffered record uses
+func externalRecordSize(r *ExternalRecord) int64 {
+	return 64 + int64(len(r.BranchID)) + int64(len(r.Payload))
+}
+
+// spillWriter appends records to a spill file
+type spillWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func createSpillFile(dir string) (*spillWriter, error) {
+	f, err := ioutil.TempFile(dir, "spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillWriter{f: f, w: bufio.NewWriterSize(f, spillBufferSize)}, nil
+}
+
+func (sw *spillWriter) uvarint(v uint64) error {
+	_, err := sw.w.Write(sw.buf[:binary.PutUvarint(sw.buf[:], v)])
+	return err
+}
+
+func (sw *spillWriter) write(r *ExternalRecord) error {
+	if len(r.BranchID) > maxStoredBranchIDLength || len(r.Payload) > maxStoredBranchIDLength {
+		return errSpillRecordSize
+	}
+	values := []uint64{uint64(r.ID), uint64(r.ParentID) + 1, uint64(r.Depth), uint64(len(r.BranchID)), uint64(len(r.Payload))}
+	for _, v := range values {
+		if err := sw.uvarint(v); err != nil {
+			return err
+		}
+	}
+	if _, err := sw.w.WriteString(r.BranchID); err != nil {
+		return err
+	}
+	_, err := sw.w.WriteString(r.Payload)
+	return err
+}
+
+// close flushes the file and returns its path
+func (sw *spillWriter) close() (string, error) {
+	if err := sw.w.Flush(); err != nil {
+		sw.f.Close()
+		return "", err
+	}
+	return sw.f.Name(), sw.f.Close()
+}
+
+// spillReader reads the records of a spill file in order
+type spillReader struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+func openSpillFile(path string) (*spillReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &spillReader{f: f, r: bufio.NewReaderSize(f, spillBufferSize)}, nil
+}
+
+func (sr *spillReader) next() (ExternalRecord, error) {
+	var values [5]uint64
+	for i := range values {
+		v, err := binary.ReadUvarint(sr.r)
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return ExternalRecord{}, err
+		}
+		values[i] = v
+	}
+	if values[3] > maxStoredBranchIDLength || values[4] > maxStoredBranchIDLength {
+		return ExternalRecord{}, errSpillRecordSize
+	}
+	data := make([]byte, values[3]+values[4])
+	if _, err := io.ReadFull(sr.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return ExternalRecord{}, err
+	}
+	return ExternalRecord{
+		ID:       uint32(values[0]),
+		ParentID: uint32(values[1] - 1),
+		Depth:    uint8(values[2]),
+		BranchID: string(data[:values[3]]),
+		Payload:  string(data[values[3]:]),
+	}, nil
+}
+
+// runSorter buffers records and spills them as sorted runs, holding no more than limit bytes of records at once
+type runSorter struct {
+	less   recordLess
+	limit  int64
+	dir    string
+	buffer []ExternalRecord
+	size   int64
+	runs   []string
+}
+
+func (rs *runSorter) add(r ExternalRecord) error {
+	rs.buffer = append(rs.buffer, r)
+	rs.size += externalRecordSize(&r)
+	if rs.size >= rs.limit {
+		return rs.flush()
+	}
+	return nil
+}
+
+func (rs *runSorter) flush() error {
+	if len(rs.buffer) == 0 {
+		return nil
+	}
+	sort.Slice(rs.buffer, func(i, j int) bool { return rs.less(&rs.buffer[i], &rs.buffer[j]) })
+	sw, err := createSpillFile(rs.dir)
+	if err != nil {
+		return err
+	}
+	for i := range rs.buffer {
+		if err := sw.write(&rs.buffer[i]); err != nil {
+			sw.close()
+			return err
+		}
+	}
+	path, err := sw.close()
+	if err != nil {
+		return err
+	}
+	rs.runs = append(rs.runs, path)
+	// Drop the buffer so its memory is released between runs
+	rs.buffer = nil
+	rs.size = 0
+	return nil
+}
+
+// finish spills what is left and returns the runs
+func (rs *runSorter) finish() ([]string, error) {
+	// flush appends the last run, read the runs after it
+	err := rs.flush()
+	return rs.runs, err
+}
+
+// runMerge is a k-way merge of sorted runs, each open run holds a read buffer of spillBufferSize
+type runMerge struct {
+	readers []*spillReader
+	heads   []ExternalRecord
+	less    recordLess
+}
+
+func (m *runMerge) Len() int           { return len(m.readers) }
+func (m *runMerge) Less(i, j int) bool { return m.less(&m.heads[i], &m.heads[j]) }
+func (m *runMerge) Swap(i, j int) {
+	m.readers[i], m.readers[j] = m.readers[j], m.readers[i]
+	m.heads[i], m.heads[j] = m.heads[j], m.heads[i]
+}
+func (m *runMerge) Push(interface{}) {}
+func (m *runMerge) Pop() interface{} {
+	last := len(m.readers) - 1
+	m.readers[last].f.Close()
+	m.readers, m.heads = m.readers[:last], m.heads[:last]
+	return nil
+}
+
+func (m *runMerge) next() (ExternalRecord, error) {
+	if len(m.readers) == 0 {
+		return ExternalRecord{}, io.EOF
+	}
+	r := m.heads[0]
+	head, err := m.readers[0].next()
+	switch err {
+	case nil:
+		m.heads[0] = head
+		heap.Fix(m, 0)
+	case io.EOF:
+		heap.Pop(m)
+	default:
+		return r, err
+	}
+	return r, nil
+}
+
+func (m *runMerge) close() {
+	for _, sr := range m.readers {
+		sr.f.Close()
+	}
+	m.readers = nil
+}
+
+// mergeRuns opens sorted runs as a single sorted source, the returned merge must be closed
+func mergeRuns(runs []string, less recordLess) (*runMerge, error) {
+	m := &runMerge{less: less}
+	for _, path := range runs {
+		sr, err := openSpillFile(path)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		head, err := sr.next()
+		if err == io.EOF {
+			sr.f.Close()
+			continue
+		}
+		if err != nil {
+			sr.f.Close()
+			m.close()
+			return nil, err
+		}
+		m.readers = append(m.readers, sr)
+		m.heads = append(m.heads, head)
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// removeRuns deletes spill files that are no longer needed
+func removeRuns(runs []string) {
+	for _, path := range runs {
+		os.Remove(path)
+	}
+}
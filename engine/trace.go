@@ -0,0 +1,111 @@
+package engine
+
+// Reasons recorded in a TraceStep for the branch ID a record ended up with
+const (
+	TraceKept             = "kept its previous branch ID"
+	TraceNoPrevious       = "had no previous branch ID"
+	TraceInvalidChars     = "previous branch ID holds characters outside of the alphabet"
+	TraceNotUnderParent   = "previous branch ID doesn't extend the parent's branch ID"
+	TraceWidthMismatch    = "previous branch ID's code isn't as wide as the sibling group needs"
+	TraceClaimedBySibling = "previous branch ID was already claimed by an earlier sibling"
+	TraceNotReached       = "not reached from a root, its parents loop or are missing"
+)
+
+// TraceStep records how a single record's branch ID was assigned
+type TraceStep struct {
+	ID           uint32 `json:"id"`
+	OldBranchID  string `json:"oldBranchId"`
+	NewBranchID  string `json:"newBranchId"`
+	SiblingCount int    `json:"siblingCount"`
+	Width        int    `json:"width"`
+	Kept         bool   `json:"kept"`
+	Reason       string `json:"reason"`
+}
+
+// BranchTrace explains a record's branch ID, one step for each ancestor from the root down followed by the record
+type BranchTrace struct {
+	ID    uint32      `json:"id"`
+	Steps []TraceStep `json:"steps"`
+}
+
+// TraceBranchIDs asks the following calculations to record how the branch IDs of the given records, and of all of
+// their ancestors, are assigned. Only the selected records pay for the bookkeeping.
+func (group *Group) TraceBranchIDs(ids ...uint32) {
+	group.traceIDs = append(group.traceIDs, ids...)
+}
+
+// BranchTrace returns the recorded assignment of a traced record's branch ID after CalculateHierarchy
+func (group *Group) BranchTrace(id uint32) (BranchTrace, bool) {
+	if _, ok := group.tracing[id]; !ok {
+		return BranchTrace{}, false
+	}
+	trace := BranchTrace{ID: id}
+	for _, a := range group.upline(id) {
+		trace.Steps = append(trace.Steps, *group.tracing[a])
+	}
+	trace.Steps = append(trace.Steps, *group.tracing[id])
+	return trace, true
+}
+
+// startTracing prepares a step for every traced record and each of its ancestors
+func (group *Group) startTracing() {
+	group.tracing = nil
+	if len(group.traceIDs) == 0 {
+		return
+	}
+	group.tracing = make(map[uint32]*TraceStep)
+	for _, id := range group.traceIDs {
+		if _, ok := group.Members[id]; !ok {
+			continue
+		}
+		for _, a := range append(group.upline(id), id) {
+			if _, ok := group.tracing[a]; !ok {
+				group.tracing[a] = &TraceStep{ID: a, OldBranchID: group.Members[a].GetBranchID(), Reason: TraceNotReached}
+			}
+		}
+	}
+}
+
+// upline walks parents up from a record returning them ordered from the root down, stopping at a parent loop
+func (group *Group) upline(id uint32) []uint32 {
+	var ids []uint32
+	seen := map[uint32]void{id: emptyVal}
+	r := group.Members[id]
+	for {
+		p, ok := group.Members[r.GetParentID()]
+		if !ok {
+			break
+		}
+		if _, loop := seen[p.GetID()]; loop {
+			break
+		}
+		seen[p.GetID()] = emptyVal
+		ids = append([]uint32{p.GetID()}, ids...)
+		r = p
+	}
+	return ids
+}
+
+// traceSiblingGroup records the sibling group a traced record was handled in
+func (group *Group) traceSiblingGroup(id uint32, siblingCount int, width int) {
+	if step, ok := group.tracing[id]; ok {
+		step.SiblingCount = siblingCount
+		step.Width = width
+		step.Reason = TraceNoPrevious
+	}
+}
+
+// traceReason records why a traced record kept or lost its previous branch ID
+func (group *Group) traceReason(id uint32, reason string) {
+	if step, ok := group.tracing[id]; ok {
+		step.Reason = reason
+		step.Kept = reason == TraceKept
+	}
+}
+
+// traceAssigned records the branch ID a traced record ended up with
+func (group *Group) traceAssigned(id uint32, branchID string) {
+	if step, ok := group.tracing[id]; ok {
+		step.NewBranchID = branchID
+	}
+}
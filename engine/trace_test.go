@@ -0,0 +1,51 @@
+package engine
+
+import "testing"
+
+func TestTraceBranchIDs(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "b", ""},
+		{2, 1, "bᶂ", ""},
+		{3, 1, "ba", ""},
+		{4, 1, "ba", ""},
+		{5, 1, "xx", ""},
+		{6, 1, "ca", ""},
+		{7, 8, "", ""},
+		{8, 7, "", ""},
+	}
+	data := Group{Members: make(map[uint32]Record)}
+	data.SetChars(chars)
+	data.SetIDOrder(true)
+	for _, tt := range dataTable {
+		data.Members[tt.ID] = &record{id: tt.ID, parentID: tt.parentID, branchID: tt.branchID}
+	}
+	data.TraceBranchIDs(2, 4, 5, 6, 7)
+	data.CalculateHierarchy()
+
+	expected := map[uint32]TraceStep{
+		1: {ID: 1, OldBranchID: "b", NewBranchID: "b", SiblingCount: 1, Width: 1, Kept: true, Reason: TraceKept},
+		2: {ID: 2, OldBranchID: "bᶂ", NewBranchID: "bb", SiblingCount: 5, Width: 1, Reason: TraceInvalidChars},
+		4: {ID: 4, OldBranchID: "ba", NewBranchID: "bc", SiblingCount: 5, Width: 1, Reason: TraceClaimedBySibling},
+		5: {ID: 5, OldBranchID: "xx", NewBranchID: "bd", SiblingCount: 5, Width: 1, Reason: TraceNotUnderParent},
+		6: {ID: 6, OldBranchID: "ca", NewBranchID: "be", SiblingCount: 5, Width: 1, Reason: TraceNotUnderParent},
+		7: {ID: 7, Reason: TraceNotReached},
+	}
+	for _, id := range []uint32{2, 4, 5, 6, 7} {
+		trace, ok := data.BranchTrace(id)
+		if !ok {
+			t.Fatalf("Expected a trace for %v", id)
+		}
+		if trace.Steps[len(trace.Steps)-1] != expected[id] {
+			t.Errorf("Expected %+v, instead held %+v", expected[id], trace.Steps[len(trace.Steps)-1])
+		}
+		if id != 7 && (len(trace.Steps) != 2 || trace.Steps[0] != expected[1]) {
+			t.Errorf("Expected the root step %+v, instead held %+v", expected[1], trace.Steps)
+		}
+	}
+	if _, ok := data.BranchTrace(3); ok {
+		t.Errorf("Expected no trace for a record that wasn't selected")
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+import "fmt"
+
+// RecordImpact is a record whose branch ID or depth would change
+type RecordImpact struct {
+	ID          uint32 `json:"id"`
+	OldBranchID string `json:"oldBranchId"`
+	NewBranchID string `json:"newBranchId"`
+	OldDepth    int    `json:"oldDepth"`
+	NewDepth    int    `json:"newDepth"`
+}
+
+// ImpactReport describes what a set of hypothetical parent changes would do to the hierarchy. When any change would
+// make a record its own ancestor the changes are listed in Cycles and nothing else is calculated.
+type ImpactReport struct {
+	Cycles       []uint32       `json:"cycles,omitempty"`
+	ChainChanges int            `json:"chainChanges"`
+	DepthChanges int            `json:"depthChanges"`
+	Impacts      []RecordImpact `json:"impacts"`
+}
+
+// simulatedRecord is a writable copy of a record used to recalculate a hypothetical hierarchy
+type simulatedRecord struct {
+	id       uint32
+	parentID uint32
+	children []uint32
+	branchID string
+	depth    uint8
+}
+
+func (r *simulatedRecord) GetID() uint32 {
+	return r.id
+}
+func (r *simulatedRecord) GetParentID() uint32 {
+	return r.parentID
+}
+func (r *simulatedRecord) GetChildren() []uint32 {
+	return r.children
+}
+func (r *simulatedRecord) SetChildren(children []uint32) {
+	r.children = children
+}
+func (r *simulatedRecord) GetBranchID() string {
+	return r.branchID
+}
+func (r *simulatedRecord) SetBranchID(branchID string) {
+	r.branchID = branchID
+}
+func (r *simulatedRecord) SetBranchDepth(depth uint8) {
+	r.depth = depth
+}
+
+// WhatIf reports the impact of moving records to new parents, given as record ID to new parent ID with Uint32Max
+// making the record a root. The group itself is left untouched.
+func (group *Group) WhatIf(changes map[uint32]uint32) (ImpactReport, error) {
+	return group.Snapshot().WhatIf(changes)
+}
+
+// WhatIf reports the impact of moving records to new parents, given as record ID to new parent ID with Uint32Max
+// making the record a root. The changes are applied to a copy of the snapshot.
+func (s *Snapshot) WhatIf(changes map[uint32]uint32) (ImpactReport, error) {
+	report := ImpactReport{}
+	if len(s.group.chars) == 0 {
+		return report, fmt.Errorf("snapshot has no alphabet to recalculate with")
+	}
+	parentOf := func(id uint32) uint32 {
+		if p, ok := changes[id]; ok {
+			return p
+		}
+		return s.group.Members[id].GetParentID()
+	}
+	for id, parentID := range changes {
+		if _, ok := s.group.Members[id]; !ok {
+			return report, fmt.Errorf("record %d not found", id)
+		}
+		if _, ok := s.group.Members[parentID]; !ok && parentID != Uint32Max {
+			return report, fmt.Errorf("new parent %d of record %d not found", parentID, id)
+		}
+		// Walk the new upline, finding the record itself means it would be its own ancestor
+		seen := make(map[uint32]void)
+		for p := parentID; p != Uint32Max; p = parentOf(p) {
+			if p == id {
+				report.Cycles = append(report.Cycles, id)
+				break
+			}
+			if _, ok := seen[p]; ok {
+				break
+			}
+			if _, ok := s.group.Members[p]; !ok {
+				break
+			}
+			seen[p] = emptyVal
+		}
+	}
+	if len(report.Cycles) > 0 {
+		sortIDs(report.Cycles)
+		return report, nil
+	}
+
+	simulated := &Group{Members: make(map[uint32]Record, len(s.group.Members)), idOrder: s.group.idOrder}
+	simulated.SetChars(s.group.chars)
+	for id, v := range s.group.Members {
+		simulated.Members[id] = &simulatedRecord{id: id, parentID: parentOf(id), branchID: v.GetBranchID()}
+	}
+	simulated.CalculateHierarchy()
+
+	for _, id := range simulated.sortedIDs() {
+		before, _ := s.Record(id)
+		after := simulated.Members[id].(*simulatedRecord)
+		if before.BranchID == after.branchID && before.Depth == int(after.depth) {
+			continue
+		}
+		if before.BranchID != after.branchID {
+			report.ChainChanges++
+		}
+		if before.Depth != int(after.depth) {
+			report.DepthChanges++
+		}
+		report.Impacts = append(report.Impacts, RecordImpact{
+			ID:          id,
+			OldBranchID: before.BranchID,
+			NewBranchID: after.branchID,
+			OldDepth:    before.Depth,
+			NewDepth:    int(after.depth),
+		})
+	}
+	return report, nil
+}
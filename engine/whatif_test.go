@@ -0,0 +1,54 @@
+package engine
+
+import "testing"
+
+func TestWhatIf(t *testing.T) {
+	reportMem = false
+	reportTimeTracking = false
+
+	dataTable := []dataSeed{
+		{1, Uint32Max, "", ""},
+		{2, 1, "", ""},
+		{3, 1, "", ""},
+		{4, 2, "", ""},
+		{5, 4, "", ""},
+		{6, 3, "", ""},
+	}
+	data := verifyHierarchy(t, dataTable)
+	branchIDs := make(map[uint32]string)
+	for id, r := range data.Members {
+		branchIDs[id] = r.GetBranchID()
+	}
+
+	// Move 4 and its downline under 6
+	report, err := data.WhatIf(map[uint32]uint32{4: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RecordImpact{
+		{ID: 4, OldBranchID: "aaa", NewBranchID: "abaa", OldDepth: 3, NewDepth: 4},
+		{ID: 5, OldBranchID: "aaaa", NewBranchID: "abaaa", OldDepth: 4, NewDepth: 5},
+	}
+	if report.ChainChanges != 2 || report.DepthChanges != 2 || len(report.Impacts) != len(expected) {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for i := range expected {
+		if report.Impacts[i] != expected[i] {
+			t.Errorf("Expected %+v, instead held %+v", expected[i], report.Impacts[i])
+		}
+	}
+	for id, r := range data.Members {
+		verifyBranchID(t, branchIDs[id], r.GetBranchID())
+	}
+
+	// Moving 2 under its own downline loops
+	report, err = data.WhatIf(map[uint32]uint32{2: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUint32s(t, []uint32{2}, report.Cycles)
+
+	if _, err := data.WhatIf(map[uint32]uint32{2: 99}); err == nil {
+		t.Errorf("Expected an error moving to a missing parent")
+	}
+}
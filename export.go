@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+const defaultOutputDir = "./output"
+
+// outputPath returns the path of a file in the configured output directory, creating the directory if needed
+func outputPath(fileName string) (string, error) {
+	dir := os.Getenv("OUTPUT_DIR")
+	if len(dir) == 0 {
+		dir = defaultOutputDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+// createExportFile opens a new file in the configured output directory named after the query job and report
+func createExportFile(jobID string, fileName string) (*os.File, error) {
+	path, err := outputPath(jobID + "-" + fileName)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// exportCSV writes a single report to its own CSV export file
+func exportCSV(jobID string, name string, write func(io.Writer) error) {
+	exportFile(jobID, name+".csv", write)
+}
+
+// exportFile writes a single report to its own export file, failures are reported but don't stop the run
+func exportFile(jobID string, name string, write func(io.Writer) error) {
+	f, err := createExportFile(jobID, name)
+	if err != nil {
+		fmt.Printf("Error creating %s export %v\n", name, err)
+		return
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		fmt.Printf("Error writing %s export %v\n", name, err)
+		return
+	}
+	fmt.Printf("Wrote %s to %s\n", name, f.Name())
+}
+
+func exportGenerationCounts(g *engine.Group, jobID string, mode parentMode, levels int) {
+	exportCSV(jobID, mode+"-generations", func(w io.Writer) error {
+		return g.WriteGenerationCountsCSV(w, levels)
+	})
+}
+
+func exportRollups(g *engine.Group, jobID string, mode parentMode) {
+	exportCSV(jobID, mode+"-rollups", func(w io.Writer) error {
+		return g.WriteRollupsCSV(w)
+	})
+}
+
+func exportClosure(g *engine.Group, jobID string, mode parentMode, maxDistance int) {
+	exportCSV(jobID, mode+"-closure", func(w io.Writer) error {
+		return g.WriteClosureCSV(w, maxDistance)
+	})
+}
+
+// exportHierarchyComparison compares the Parent_1 and Parent_2 trees of every record, returning the summary when
+// the export succeeded
+func exportHierarchyComparison(groups map[string]*engine.Group, jobID string) *engine.ComparisonSummary {
+	var summary *engine.ComparisonSummary
+	exportCSV(jobID, "hierarchy-comparison", func(w io.Writer) error {
+		s, err := engine.WriteHierarchyComparisonCSV(w, groups[parent1], groups[parent2])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Hierarchy comparison %+v\n", s)
+		summary = &s
+		return nil
+	})
+	return summary
+}
+
+// orgHost names the files kept for an org after its host
+func orgHost(instanceURL string) string {
+	if u, err := url.Parse(instanceURL); err == nil && len(u.Host) > 0 {
+		return u.Host
+	}
+	return instanceURL
+}
+
+// snapshotPath is where the latest snapshot of an org's hierarchy is kept, named after the org's host
+func snapshotPath(instanceURL string, mode parentMode) (string, error) {
+	return outputPath(orgHost(instanceURL) + "-" + mode + ".snapshot")
+}
+
+// loadSnapshot reads the org's stored snapshot of a hierarchy, returning nil when there is none
+func loadSnapshot(instanceURL string, mode parentMode) *engine.Snapshot {
+	path, err := snapshotPath(instanceURL, mode)
+	if err != nil {
+		fmt.Printf("Error locating %s snapshot %v\n", mode, err)
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Error opening %s snapshot %v\n", mode, err)
+		return nil
+	}
+	defer f.Close()
+	s, err := engine.ReadSnapshot(f)
+	if err != nil {
+		fmt.Printf("Error reading %s snapshot %v\n", mode, err)
+		return nil
+	}
+	return s
+}
+
+// exportSnapshotDiff writes the changes since the previous run's snapshot as CSV and NDJSON for review
+func exportSnapshotDiff(previous *engine.Snapshot, current *engine.Snapshot, jobID string, mode parentMode) {
+	if previous.AlphabetFingerprint() != "" && previous.AlphabetFingerprint() != current.AlphabetFingerprint() {
+		fmt.Printf("The previous %s snapshot was built with alphabet %s, chains changed by the alphabet show as moves\n",
+			mode, previous.AlphabetFingerprint())
+	}
+	exportCSV(jobID, mode+"-diff", func(w io.Writer) error {
+		summary, err := engine.WriteDiffCSV(w, previous, current)
+		fmt.Printf("Changes to %s since the previous run %v\n", mode, summary)
+		return err
+	})
+	exportFile(jobID, mode+"-diff.ndjson", func(w io.Writer) error {
+		_, err := engine.WriteDiffNDJSON(w, previous, current)
+		return err
+	})
+}
+
+// saveSnapshot replaces the org's stored snapshot of a hierarchy, writing to a temporary file first so a failed
+// write never leaves a partial snapshot behind
+func saveSnapshot(s *engine.Snapshot, instanceURL string, mode parentMode) {
+	path, err := snapshotPath(instanceURL, mode)
+	if err != nil {
+		fmt.Printf("Error locating %s snapshot %v\n", mode, err)
+		return
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		fmt.Printf("Error creating %s snapshot %v\n", mode, err)
+		return
+	}
+	_, err = s.WriteTo(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		fmt.Printf("Error writing %s snapshot %v\n", mode, err)
+		os.Remove(path + ".tmp")
+		return
+	}
+	fmt.Printf("Saved %s snapshot to %s\n", mode, path)
+}
+
+// exportBranchTraces writes the explanation of each traced record's branch ID as JSON
+func exportBranchTraces(g *engine.Group, jobID string, mode parentMode, ids []uint32) {
+	traces := make([]engine.BranchTrace, 0, len(ids))
+	for _, id := range ids {
+		if trace, ok := g.BranchTrace(id); ok {
+			traces = append(traces, trace)
+		} else {
+			fmt.Printf("No %s trace for %d, it wasn't loaded\n", mode, id)
+		}
+	}
+	exportFile(jobID, mode+"-trace.json", func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(traces)
+	})
+}
+
+// exportFieldChanges writes the old and new value of every changed field, ordered by customer number
+func exportFieldChanges(members map[uint32]engine.MultiRecord, changes map[uint32][]fieldChange, jobID string) {
+	ids := make([]uint32, 0, len(changes))
+	for id := range changes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	exportCSV(jobID, "changes", func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "salesforce_id", "field", "old_value", "new_value"}); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			sfID := members[id].(*record).sfID
+			for _, c := range changes[id] {
+				err := cw.Write([]string{strconv.FormatUint(uint64(id), 10), sfID, c.field,
+					fmt.Sprint(c.oldValue), fmt.Sprint(c.newValue)})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// exportChainValidation writes the records whose loaded chains fail validation
+func exportChainValidation(g *engine.Group, jobID string, mode parentMode) {
+	issues := g.Validate()
+	fmt.Printf("%d %s lineage chains failed validation\n", len(issues), mode)
+	exportCSV(jobID, mode+"-validation", func(w io.Writer) error {
+		return engine.WriteValidationCSV(w, issues)
+	})
+}
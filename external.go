@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/bulkQuery"
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/sessionovd"
+
+	"github.com/aheber/go-sfdc/bulk"
+)
+
+// Columns of the query rows spilled by a low memory run
+const (
+	spillIDColumn = iota
+	spillSFIDColumn
+	spillParent1Column
+	spillParent2Column
+	spillChain1Column
+	spillDepth1Column
+	spillChain2Column
+	spillDepth2Column
+	spillColumns
+)
+
+// payloadSeparator splits the Salesforce ID, loaded depth and loaded chain carried through the engine
+const payloadSeparator = "\x00"
+
+// externalUpdate is a tree of a record whose chain or depth a low memory run changed
+type externalUpdate struct {
+	sfID           string
+	mode           parentMode
+	loaded         treeValues
+	values         treeValues
+	chainMaxLength int
+}
+
+// changes lists the fields of the tree the run changed
+func (u externalUpdate) changes() []fieldChange {
+	return treeChanges(u.mode, u.loaded, u.values, u.chainMaxLength, false)
+}
+
+// Fields used to export data for SFDC Bulk API, used by package. Only the changed fields are listed like
+// record.Fields.
+func (u externalUpdate) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"Id": u.sfID,
+	}
+	for _, c := range u.changes() {
+		fields[c.field] = bulkValue(c.newValue)
+	}
+	return fields
+}
+
+// InsertNull used to submit values in nullable mode, used by package
+func (u externalUpdate) InsertNull() bool {
+	return false
+}
+
+// parseCustomerNumber reads the record ID from a customer number, which carries a two character suffix
+func parseCustomerNumber(value string) (uint32, error) {
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid customer number %q", value)
+	}
+	id, err := strconv.ParseUint(value[:len(value)-2], 10, 32)
+	return uint32(id), err
+}
+
+// parentColumns are the spilled columns of a tree's parent, chain and depth
+func parentColumns(mode parentMode) (parent int, chain int, depth int) {
+	if mode == parent2 {
+		return spillParent2Column, spillChain2Column, spillDepth2Column
+	}
+	return spillParent1Column, spillChain1Column, spillDepth1Column
+}
+
+// calculateExternalTrees runs a job admitted with the low memory strategy. The query rows are spilled to a local
+// file keeping only the Salesforce ID lookup in memory, each tree is streamed through engine.CalculateExternal and
+// only the trees whose chain or depth changed are held for the update.
+func calculateExternalTrees(session *sessionovd.Session, result bulkQuery.BulkQueryResults, opts jobOptions,
+	alphabet []string, run *runResult) error {
+	dir, err := ioutil.TempDir("", "lineage-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	rowsPath := dir + "/rows.csv"
+	idLookupTable, err := spillQueryRows(result, rowsPath, opts)
+	if err != nil {
+		return err
+	}
+	run.Records = len(idLookupTable)
+	fmt.Printf("Spilled %d records for the low memory strategy\n", len(idLookupTable))
+
+	stored, err := storedAlphabets(session.InstanceURL(), nil)
+	if err != nil {
+		return err
+	}
+	run.StoredAlphabets = stored
+	run.AlphabetUnrecorded = warnUnrecordedAlphabet(stored, run.Alphabet)
+	if err := opts.checkAlphabetChange(run.Alphabet, stored); err != nil {
+		run.Refused = err.Error()
+		return fmt.Errorf("refusing to update chains, %v", err)
+	}
+
+	chainMaxLength := 0
+	if opts.ChainContinuation {
+		chainMaxLength = opts.chainMaxLength()
+	}
+	fieldSets := make(map[string][]string)
+	updates := make(map[string][]bulk.Record)
+	run.Chains = make(map[string]engine.ChainProjection)
+	for _, mode := range parentModes {
+		fields := []string{"Id"}
+		for _, v := range (treeValues{}).fieldValues(mode, chainMaxLength, false) {
+			fields = append(fields, v.field)
+		}
+		fieldSets[mode] = fields
+		longest := engine.ChainProjection{}
+		err := calculateExternalTree(dir, rowsPath, mode, idLookupTable, alphabet, func(r engine.ExternalRecord) error {
+			if n := utf8.RuneCountInString(r.BranchID); n > longest.MaxLength {
+				longest = engine.ChainProjection{MaxLength: n, ID: r.ID, Depth: int(r.Depth)}
+			}
+			if n := utf8.RuneCountInString(r.BranchID); n > opts.chainCapacity() {
+				if run.OversizeChains == nil {
+					run.OversizeChains = make(map[string]int)
+				}
+				run.OversizeChains[mode]++
+				return nil
+			}
+			payload := strings.SplitN(r.Payload, payloadSeparator, 3)
+			u := externalUpdate{sfID: payload[0], mode: mode, chainMaxLength: chainMaxLength,
+				loaded: treeValues{branchID: payload[2], branchDepth: parseDepth(payload[1])},
+				values: treeValues{branchID: r.BranchID, branchDepth: r.Depth}}
+			if len(u.changes()) > 0 {
+				updates[mode] = append(updates[mode], u)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("calculating %s: %v", mode, err)
+		}
+		run.Chains[mode] = longest
+		fmt.Printf("Calculated %s with the low memory strategy, %d trees changed\n", mode, len(updates[mode]))
+		run.Updates += len(updates[mode])
+	}
+	warnOversizeChains(run.OversizeChains, opts)
+	run.FailedUpdates, err = submitUpdates(session, fieldSets, updates)
+	return err
+}
+
+// spillQueryRows writes the query rows to a CSV file in spill column order, returning the Salesforce ID lookup
+func spillQueryRows(result bulkQuery.BulkQueryResults, path string, opts jobOptions) (map[string]uint32, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	cw := csv.NewWriter(bw)
+	idLookupTable := make(map[string]uint32)
+	row := make([]string, spillColumns)
+	for {
+		rows, err := result.Records.ReadAll()
+		result.CloseCSV()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			id, err := parseCustomerNumber(r[result.ColumnMap["Customer_Number__c"]])
+			if err != nil {
+				continue
+			}
+			sfID := r[result.ColumnMap["Id"]]
+			idLookupTable[sfID] = id
+			row[spillIDColumn] = strconv.FormatUint(uint64(id), 10)
+			row[spillSFIDColumn] = sfID
+			for _, mode := range parentModes {
+				prefix := fieldPrefix(mode)
+				parent, chain, depth := parentColumns(mode)
+				row[parent] = r[result.ColumnMap[prefix+"__c"]]
+				row[chain] = r[result.ColumnMap[prefix+"_Lineage_Chain__c"]]
+				if opts.ChainContinuation {
+					row[chain] = engine.JoinChain(row[chain], r[result.ColumnMap[chainContinuationField(mode)]])
+				}
+				row[depth] = r[result.ColumnMap[prefix+"_Lineage_Depth__c"]]
+			}
+			if err := cw.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		if result.Done() {
+			break
+		}
+		if result, err = result.Next(); err != nil {
+			return nil, err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+	return idLookupTable, bw.Flush()
+}
+
+// calculateExternalTree streams the spilled rows of a tree through engine.CalculateExternal, spilling its runs to
+// dir. Parents that weren't loaded make a record a root, the same as the in memory run.
+func calculateExternalTree(dir string, rowsPath string, mode parentMode, idLookupTable map[string]uint32, alphabet []string,
+	emit func(engine.ExternalRecord) error) error {
+	f, err := os.Open(rowsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr := csv.NewReader(bufio.NewReader(f))
+	cr.ReuseRecord = true
+	parent, chain, depth := parentColumns(mode)
+	next := func() (engine.ExternalRecord, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return engine.ExternalRecord{}, err
+		}
+		id, err := strconv.ParseUint(row[spillIDColumn], 10, 32)
+		if err != nil {
+			return engine.ExternalRecord{}, err
+		}
+		parentID := engine.Uint32Max
+		if p, ok := idLookupTable[row[parent]]; ok {
+			parentID = p
+		}
+		return engine.ExternalRecord{
+			ID:       uint32(id),
+			ParentID: parentID,
+			BranchID: row[chain],
+			Payload:  strings.Join([]string{row[spillSFIDColumn], row[depth], row[chain]}, payloadSeparator),
+		}, nil
+	}
+	return engine.CalculateExternal(next, alphabet, engine.ExternalOptions{Dir: dir}, emit)
+}
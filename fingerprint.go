@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+// alphabetRecord is the alphabet an org's stored chains were last written with
+type alphabetRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Characters  int       `json:"characters"`
+	JobID       string    `json:"jobId"`
+	Recorded    time.Time `json:"recorded"`
+}
+
+// alphabetRecordPath is where the alphabet of an org's stored chains is kept, named after the org's host
+func alphabetRecordPath(instanceURL string) (string, error) {
+	return outputPath(orgHost(instanceURL) + "-alphabet.json")
+}
+
+// loadAlphabetRecord reads the alphabet the org's chains were last written with, returning nil when there is none
+func loadAlphabetRecord(instanceURL string) (*alphabetRecord, error) {
+	path, err := alphabetRecordPath(instanceURL)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a := &alphabetRecord{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return a, nil
+}
+
+// saveAlphabetRecord replaces the alphabet recorded for the org, writing to a temporary file first like snapshots
+func saveAlphabetRecord(a alphabetRecord, instanceURL string) {
+	path, err := alphabetRecordPath(instanceURL)
+	if err == nil {
+		var b []byte
+		if b, err = json.MarshalIndent(a, "", "  "); err == nil {
+			if err = os.WriteFile(path+".tmp", b, 0644); err == nil {
+				err = os.Rename(path+".tmp", path)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error recording alphabet %v\n", err)
+		os.Remove(path + ".tmp")
+		return
+	}
+	fmt.Printf("Recorded alphabet %s to %s\n", a.Fingerprint, path)
+}
+
+// storedAlphabets lists the distinct fingerprints of the alphabets the org's chains were written with, from the
+// org's alphabet record and the alphabet field of every loaded record
+func storedAlphabets(instanceURL string, members map[uint32]engine.MultiRecord) ([]string, error) {
+	seen := make(map[string]bool)
+	a, err := loadAlphabetRecord(instanceURL)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil && a.Fingerprint != "" {
+		seen[a.Fingerprint] = true
+	}
+	for _, m := range members {
+		if f := m.(*record).loadedAlphabet; f != "" {
+			seen[f] = true
+		}
+	}
+	stored := make([]string, 0, len(seen))
+	for f := range seen {
+		stored = append(stored, f)
+	}
+	sort.Strings(stored)
+	return stored, nil
+}
+
+// checkAlphabetChange fails when chains were stored with a different alphabet than the active one, unless the job
+// confirms the active alphabet's fingerprint. Rewriting them reassigns every chain holding a removed character.
+func (o jobOptions) checkAlphabetChange(active string, stored []string) error {
+	if o.ConfirmAlphabet == active {
+		return nil
+	}
+	for _, f := range stored {
+		if f != active {
+			return fmt.Errorf("stored chains were built with alphabet %s but the active alphabet is %s, "+
+				"set confirmAlphabet to %s to rewrite them", f, active, active)
+		}
+	}
+	return nil
+}
+
+// warnUnrecordedAlphabet reports whether no alphabet was recorded for the org's chains, neither in the org's alphabet
+// record nor the alphabet field, warning that checkAlphabetChange passes without anything to check
+func warnUnrecordedAlphabet(stored []string, active string) bool {
+	if len(stored) > 0 {
+		return false
+	}
+	fmt.Printf("WARNING: no alphabet is recorded for the org's stored chains, they can't be checked against "+
+		"alphabet %s\n", active)
+	return true
+}
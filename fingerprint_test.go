@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+func TestCheckAlphabetChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    jobOptions
+		stored  []string
+		refused bool
+	}{
+		{"no stored alphabet", jobOptions{}, nil, false},
+		{"matching stored alphabet", jobOptions{}, []string{"active"}, false},
+		{"different stored alphabet", jobOptions{}, []string{"active", "old"}, true},
+		{"confirmed", jobOptions{ConfirmAlphabet: "active"}, []string{"active", "old"}, false},
+		{"confirmed another alphabet", jobOptions{ConfirmAlphabet: "old"}, []string{"old"}, true},
+	}
+	for _, test := range tests {
+		err := test.opts.checkAlphabetChange("active", test.stored)
+		if (err != nil) != test.refused {
+			t.Errorf("%s: expected refused %v, instead held %v", test.name, test.refused, err)
+		}
+	}
+}
+
+func TestStoredAlphabets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alphabet-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("OUTPUT_DIR", os.Getenv("OUTPUT_DIR"))
+	os.Setenv("OUTPUT_DIR", dir)
+	const instanceURL = "https://example.my.salesforce.com"
+
+	stored, err := storedAlphabets(instanceURL, nil)
+	if err != nil || len(stored) != 0 {
+		t.Errorf("Expected no stored alphabets for a new org, instead held %v %v", stored, err)
+	}
+	if !warnUnrecordedAlphabet(stored, "active") {
+		t.Errorf("Expected a new org to be reported as having no recorded alphabet")
+	}
+
+	saveAlphabetRecord(alphabetRecord{Fingerprint: "recorded", Characters: 2, Recorded: time.Now().UTC()}, instanceURL)
+	members := map[uint32]engine.MultiRecord{}
+	for i, loaded := range []string{"field", "", "recorded"} {
+		r := newRecord(uint32(i), "sf", &map[string]uint32{})
+		r.loadedAlphabet = loaded
+		members[r.id] = r
+	}
+	stored, err = storedAlphabets(instanceURL, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, []string{"field", "recorded"}) {
+		t.Errorf("Expected the recorded and field alphabets, instead held %v", stored)
+	}
+	if warnUnrecordedAlphabet(stored, "active") {
+		t.Errorf("Expected an org with stored alphabets to be checked")
+	}
+}
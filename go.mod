@@ -1,5 +1,8 @@
 module git.doterra.net/salesforce/hierarchy-calculation-engine
 
-go 1.12
+go 1.16
 
-require github.com/aheber/go-sfdc v0.0.0-20190919040515-3694a635629a
+require (
+	github.com/aheber/go-sfdc v0.0.0-20190919040515-3694a635629a
+	golang.org/x/text v0.3.7
+)
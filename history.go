@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/bulkQuery"
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+const (
+	// historyTimestampLayout is the layout of CreatedDate in Bulk API query results
+	historyTimestampLayout = "2006-01-02T15:04:05.000-0700"
+	// historyDirEnv is the directory parent history files are read from, files outside of it can't be requested
+	historyDirEnv     = "HISTORY_DIR"
+	defaultHistoryDir = "./history"
+)
+
+// parentChange is a single change of a parent field recorded in the Salesforce field history
+type parentChange struct {
+	date    time.Time
+	oldSFID string
+	newSFID string
+}
+
+// asOfDates lists the dates requested for as-of calculation, the explicit dates followed by the month ends
+func (o jobOptions) asOfDates() ([]time.Time, error) {
+	var dates []time.Time
+	for _, v := range o.AsOfDates {
+		date, err := time.Parse(engine.HistoryDateLayout, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid as of date %q: %v", v, err)
+		}
+		dates = append(dates, date)
+	}
+	if o.MonthEndsFrom != "" || o.MonthEndsTo != "" {
+		from, err := time.Parse(engine.HistoryDateLayout, o.MonthEndsFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid month ends from %q: %v", o.MonthEndsFrom, err)
+		}
+		to, err := time.Parse(engine.HistoryDateLayout, o.MonthEndsTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid month ends to %q: %v", o.MonthEndsTo, err)
+		}
+		dates = append(dates, engine.MonthEnds(from, to)...)
+	}
+	return dates, nil
+}
+
+// validateHistory checks the as of dates and history files of a request before it's queued
+func (o jobOptions) validateHistory() error {
+	if _, err := o.asOfDates(); err != nil {
+		return err
+	}
+	for mode, name := range o.HistoryFiles {
+		if mode != parent1 && mode != parent2 {
+			return fmt.Errorf("history file for unknown parent mode %q", mode)
+		}
+		if _, err := historyFilePath(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyFilePath resolves a requested parent history file, which must be the name of a file in the history directory
+func historyFilePath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("history file %q must be the name of a file in %s", name, historyDirEnv)
+	}
+	dir := os.Getenv(historyDirEnv)
+	if len(dir) == 0 {
+		dir = defaultHistoryDir
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// loadParentHistories reads the parent history of each tree, from the configured history CSV when there is one
+// and from the Salesforce field history otherwise
+func loadParentHistories(conn bulkQuery.Connection, members map[uint32]engine.MultiRecord,
+	idLookupTable map[string]uint32, opts jobOptions) (map[parentMode]engine.ParentHistory, error) {
+	histories := make(map[parentMode]engine.ParentHistory)
+	var changes map[parentMode]map[uint32][]parentChange
+	for _, mode := range parentModes {
+		if name, ok := opts.HistoryFiles[mode]; ok {
+			path, err := historyFilePath(name)
+			if err != nil {
+				return nil, err
+			}
+			h, err := readParentHistoryFile(path)
+			if err != nil {
+				return nil, err
+			}
+			histories[mode] = h
+			continue
+		}
+		if changes == nil {
+			var err error
+			if changes, err = queryParentChanges(conn, idLookupTable); err != nil {
+				return nil, err
+			}
+		}
+		histories[mode] = buildParentHistory(members, mode, changes[mode], idLookupTable)
+	}
+	return histories, nil
+}
+
+func readParentHistoryFile(path string) (engine.ParentHistory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return engine.ReadParentHistoryCSV(f)
+}
+
+// queryParentChanges reads the changes to both parent fields from AccountHistory. Lookup changes are tracked as a
+// pair of rows, one with the IDs and one with the names, only the rows whose values are known account IDs are kept.
+func queryParentChanges(conn bulkQuery.Connection, idLookupTable map[string]uint32) (map[parentMode]map[uint32][]parentChange, error) {
+	fieldModes := map[string]parentMode{"Parent_1__c": parent1, "Parent_2__c": parent2}
+	q := "SELECT AccountId, Field, OldValue, NewValue, CreatedDate FROM AccountHistory" +
+		" WHERE Field IN ('Parent_1__c', 'Parent_2__c')"
+	resp, err := bulkQuery.SubmitQueryJob(q, conn)
+	if err != nil {
+		return nil, err
+	}
+	if resp, err = bulkQuery.WaitForQueryJobCompletion(resp.ID, conn); err != nil {
+		return nil, err
+	}
+	result, err := bulkQuery.RetrieveBulkQueryResults(resp.ID, conn, retrieveRecordCount, "")
+	if err != nil {
+		return nil, err
+	}
+
+	isAccountID := func(sfID string) bool {
+		_, ok := idLookupTable[sfID]
+		return sfID == "" || ok
+	}
+	changes := map[parentMode]map[uint32][]parentChange{parent1: {}, parent2: {}}
+	for {
+		rows, err := result.Records.ReadAll()
+		result.CloseCSV()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			id, ok := idLookupTable[r[result.ColumnMap["AccountId"]]]
+			mode, tracked := fieldModes[r[result.ColumnMap["Field"]]]
+			oldSFID, newSFID := r[result.ColumnMap["OldValue"]], r[result.ColumnMap["NewValue"]]
+			if !ok || !tracked || oldSFID == newSFID || !isAccountID(oldSFID) || !isAccountID(newSFID) {
+				continue
+			}
+			date, err := time.Parse(historyTimestampLayout, r[result.ColumnMap["CreatedDate"]])
+			if err != nil {
+				return nil, fmt.Errorf("invalid history date for %d: %v", id, err)
+			}
+			// Parents are effective dated by day
+			date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+			changes[mode][id] = append(changes[mode][id], parentChange{date: date, oldSFID: oldSFID, newSFID: newSFID})
+		}
+		if result.Done() {
+			break
+		}
+		if result, err = result.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// buildParentHistory replays the recorded changes of a tree into dated periods ending with the current parent.
+// Salesforce doesn't record when a record joined so every record is treated as existing from the start.
+func buildParentHistory(members map[uint32]engine.MultiRecord, mode parentMode, changes map[uint32][]parentChange,
+	idLookupTable map[string]uint32) engine.ParentHistory {
+	parentID := func(sfID string) uint32 {
+		if id, ok := idLookupTable[sfID]; ok {
+			return id
+		}
+		return engine.Uint32Max
+	}
+	history := engine.ParentHistory{}
+	for id, m := range members {
+		current := m.(*record).tree(mode).parentSFID
+		var from time.Time
+		c := changes[id]
+		sort.SliceStable(c, func(i, j int) bool { return c[i].date.Before(c[j].date) })
+		for _, change := range c {
+			// Several changes on one day collapse into the last of them
+			if change.date.After(from) {
+				history.Add(id, engine.ParentPeriod{ParentID: parentID(change.oldSFID), From: from, To: change.date})
+				from = change.date
+			}
+		}
+		history.Add(id, engine.ParentPeriod{ParentID: parentID(current), From: from})
+	}
+	return history
+}
+
+// exportAsOfHierarchies calculates and exports each tree as it was on every requested date, each date is seeded
+// with the chains of the one before it
+func exportAsOfHierarchies(histories map[parentMode]engine.ParentHistory, dates []time.Time, alphabet []string,
+	jobID string) {
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	for _, mode := range parentModes {
+		var previous *engine.Snapshot
+		for _, date := range dates {
+			snapshot := histories[mode].CalculateAsOf(date, alphabet, previous)
+			exportCSV(jobID, mode+"-asof-"+date.Format(engine.HistoryDateLayout), func(w io.Writer) error {
+				return snapshot.WriteCSV(w)
+			})
+			fmt.Printf("Calculated %s as of %s with %d records\n", mode, date.Format(engine.HistoryDateLayout),
+				snapshot.Len())
+			previous = snapshot
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/sessionovd"
+)
+
+// defaultChainMaxLength is the length of a Salesforce text field
+const defaultChainMaxLength = 255
+
+// job is a single queued request to process an org, the session fields are read from the top level of the payload
+type job struct {
+	sessionovd.Session
+	Options jobOptions `json:"options"`
+}
+
+// jobOptions are optional settings that tailor a single run
+type jobOptions struct {
+	// GenerationLevels enables per-level downline counts for the first N levels of each tree
+	GenerationLevels int `json:"generationLevels"`
+	// RollupValueField is a numeric Account field whose values are summed, counted and ranged over each record's
+	// downline in both trees and exported, blank values count as 0
+	RollupValueField string `json:"rollupValueField"`
+	// RollupLevels also rolls the values up over the first N levels below each record
+	RollupLevels int `json:"rollupLevels"`
+	// SiblingIDOrder hands out the codes of new siblings in ID order so reruns assign the same chains
+	SiblingIDOrder bool `json:"siblingIdOrder"`
+	// Ancestry enables writing the ultimate parent lookup and ancestor path of each tree
+	Ancestry bool `json:"ancestry"`
+	// AncestorPathSFIDs writes the ancestor path as Salesforce IDs instead of customer numbers
+	AncestorPathSFIDs bool `json:"ancestorPathSalesforceIds"`
+	// LevelAncestors enables the flattened Level_1 to Level_N ancestor lookups of each tree
+	LevelAncestors int `json:"levelAncestors"`
+	// LevelAncestorsFromRecord fills Level_1 with the direct parent rather than the root
+	LevelAncestorsFromRecord bool `json:"levelAncestorsFromRecord"`
+	// ClosureTable enables exporting the ancestor/descendant closure table of each tree
+	ClosureTable bool `json:"closureTable"`
+	// ClosureMaxDistance caps the distance of exported closure pairs, 0 exports all of them
+	ClosureMaxDistance int `json:"closureMaxDistance"`
+	// RestoreParents rebuilds the parent fields from the stored lineage chains into a restore CSV
+	// instead of calculating and updating the hierarchy
+	RestoreParents bool `json:"restoreParents"`
+	// CompareHierarchies enables comparing the Parent_1 and Parent_2 trees of each record
+	CompareHierarchies bool `json:"compareHierarchies"`
+	// SaveSnapshots keeps a binary snapshot of each calculated tree in the output directory
+	SaveSnapshots bool `json:"saveSnapshots"`
+	// DiffPrevious exports the changes to each tree since the previously saved snapshot
+	DiffPrevious bool `json:"diffPrevious"`
+	// TraceIDs are customer numbers whose branch ID assignment is explained in a trace export
+	TraceIDs []uint32 `json:"traceIds"`
+	// AsOfDates are dates, as 2006-01-02, to export each tree as it was on instead of calculating and updating the
+	// hierarchy
+	AsOfDates []string `json:"asOfDates"`
+	// MonthEndsFrom and MonthEndsTo add every month end between the two dates to AsOfDates
+	MonthEndsFrom string `json:"monthEndsFrom"`
+	MonthEndsTo   string `json:"monthEndsTo"`
+	// HistoryFiles are parent history CSV file names in HISTORY_DIR by parent mode, trees without one read the
+	// Salesforce field history
+	HistoryFiles map[string]string `json:"historyFiles"`
+	// ExportChanges exports the old and new value of every changed field before the update is submitted
+	ExportChanges bool `json:"exportChanges"`
+	// ChainContinuation splits lineage chains longer than ChainMaxLength over the primary and continuation fields
+	ChainContinuation bool `json:"chainContinuation"`
+	// ChainMaxLength is the length of a lineage chain field, defaultChainMaxLength when 0
+	ChainMaxLength int `json:"chainMaxLength"`
+	// AlphabetProfile names the alphabet chains are built from, such as "ascii" or "utf8mb3", the default profile
+	// when empty. The options below narrow it further.
+	AlphabetProfile string `json:"alphabetProfile"`
+	// SafeChars builds chains from the loaded characters the alphabet linter found no issues with, chains holding
+	// the removed characters are reassigned
+	SafeChars bool `json:"safeChars"`
+	// CaseInsensitiveChars builds chains from an alphabet without characters that only differ by case, chains holding
+	// the removed characters are reassigned
+	CaseInsensitiveChars bool `json:"caseInsensitiveChars"`
+	// CollationLocale builds chains from an alphabet ordered by the locale's collation, such as "en" or "de", so
+	// sorting by lineage chain in SOQL gives tree order. Case variants are removed as well.
+	CollationLocale string `json:"collationLocale"`
+	// AlphabetField is an Account text field the active alphabet's fingerprint is written to alongside the chains,
+	// the fingerprints read back from it are checked along with the org's alphabet record
+	AlphabetField string `json:"alphabetField"`
+	// ConfirmAlphabet is the fingerprint of the active alphabet, confirming chains stored with a different alphabet
+	// may be rewritten
+	ConfirmAlphabet string `json:"confirmAlphabet"`
+	// ValidateChains exports the loaded chains that fail validation, such as those ambiguous under case folding
+	ValidateChains bool `json:"validateChains"`
+	// AllowLowMemory lets a job that doesn't fit the memory budget run with the low memory strategy instead of
+	// being rejected. The strategy only updates the lineage chains and depths and requires siblingIdOrder, other
+	// jobs are still rejected.
+	AllowLowMemory bool `json:"allowLowMemory"`
+
+	// lowMemory is set on admission when the job runs with the low memory strategy
+	lowMemory bool
+}
+
+// runResult summarizes a completed run for the run log
+type runResult struct {
+	JobID       string                            `json:"jobId"`
+	Records     int                               `json:"records"`
+	Updates     int                               `json:"updates"`
+	Comparison  *engine.ComparisonSummary         `json:"comparison,omitempty"`
+	Chains      map[string]engine.ChainProjection `json:"chains,omitempty"`
+	Admission   admission                         `json:"admission"`
+	EstimatedMB uint64                            `json:"estimatedMb"`
+	// Alphabet is the fingerprint of the alphabet the run built chains from
+	Alphabet string `json:"alphabet"`
+	// StoredAlphabets are the fingerprints the org's chains were stored with before the run
+	StoredAlphabets []string `json:"storedAlphabets,omitempty"`
+	// AlphabetUnrecorded is set when no alphabet was recorded for the org's chains, as on its first run, so the
+	// stored chains couldn't be checked against the active alphabet
+	AlphabetUnrecorded bool `json:"alphabetUnrecorded,omitempty"`
+	// FailedUpdates is the number of rows Salesforce failed to update
+	FailedUpdates int `json:"failedUpdates,omitempty"`
+	// Refused is why the run stopped before updating, empty when it didn't
+	Refused string `json:"refused,omitempty"`
+	// OversizeChains counts the trees of each parent mode left out of the update because their lineage chain is
+	// longer than the chain fields hold
+	OversizeChains map[string]int `json:"oversizeChains,omitempty"`
+	// LowMemoryUnsupported are the requested options that kept the job from the low memory strategy
+	LowMemoryUnsupported []string `json:"lowMemoryUnsupported,omitempty"`
+}
+
+func (r runResult) log() {
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Printf("Error formatting run result %v\n", err)
+		return
+	}
+	fmt.Printf("Run result: %s\n", b)
+}
+
+// alphabets caches the alphabets derived from the loaded characters by the job options building them, a collated
+// alphabet takes a few seconds to build
+var alphabets = struct {
+	sync.Mutex
+	byOptions map[string][]string
+}{byOptions: make(map[string][]string)}
+
+// alphabet is the set of characters the job builds chains from. It fails when the service runs with strict
+// alphabet linting and the alphabet holds risky characters.
+func (o jobOptions) alphabet() ([]string, error) {
+	key := fmt.Sprintf("profile=%s safe=%v caseInsensitive=%v collation=%s", o.AlphabetProfile, o.SafeChars,
+		o.CaseInsensitiveChars, o.CollationLocale)
+	alphabets.Lock()
+	defer alphabets.Unlock()
+	a, ok := alphabets.byOptions[key]
+	if !ok {
+		var err error
+		if a, err = profileChars(o.AlphabetProfile, chars); err != nil {
+			return nil, err
+		}
+		if o.SafeChars {
+			a = engine.SafeChars(a)
+		}
+		if o.CaseInsensitiveChars {
+			a = engine.CaseInsensitiveChars(a)
+		}
+		if o.CollationLocale != "" {
+			if a, err = engine.CollatedChars(a, o.CollationLocale); err != nil {
+				return nil, fmt.Errorf("building %s alphabet: %v", o.CollationLocale, err)
+			}
+		}
+		fmt.Printf("Built alphabet %s with %d characters\n", key, len(a))
+		alphabets.byOptions[key] = a
+	}
+	if strictAlphabetLint() {
+		if err := engine.CheckAlphabet(a); err != nil {
+			return nil, fmt.Errorf("%v, use the safeChars option or relax %s", err, alphabetLintEnv)
+		}
+	}
+	return a, nil
+}
+
+// validate checks the options a job can be rejected for before it's queued
+func (o jobOptions) validate() error {
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"generationLevels", o.GenerationLevels},
+		{"rollupLevels", o.RollupLevels},
+		{"levelAncestors", o.LevelAncestors},
+		{"closureMaxDistance", o.ClosureMaxDistance},
+		{"chainMaxLength", o.ChainMaxLength},
+	} {
+		if n.value < 0 {
+			return fmt.Errorf("%s can't be negative, got %d", n.name, n.value)
+		}
+	}
+	if _, err := alphabetProfile(o.AlphabetProfile); err != nil {
+		return err
+	}
+	if o.CollationLocale != "" {
+		if _, err := engine.ParseCollationLocale(o.CollationLocale); err != nil {
+			return err
+		}
+	}
+	return o.validateHistory()
+}
+
+// chainMaxLength is the length of a single lineage chain field
+func (o jobOptions) chainMaxLength() int {
+	if o.ChainMaxLength > 0 {
+		return o.ChainMaxLength
+	}
+	return defaultChainMaxLength
+}
+
+// chainCapacity is the longest lineage chain the configured fields can hold
+func (o jobOptions) chainCapacity() int {
+	if o.ChainContinuation {
+		return 2 * o.chainMaxLength()
+	}
+	return o.chainMaxLength()
+}
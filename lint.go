@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+// alphabetLintEnv set to strict refuses jobs whose alphabet holds characters the linter finds risky
+const alphabetLintEnv = "ALPHABET_LINT"
+
+func strictAlphabetLint() bool {
+	return os.Getenv(alphabetLintEnv) == "strict"
+}
+
+// lintAlphabet writes the classification of every character of an alphabet profile or CSV and returns the exit
+// status
+func lintAlphabet(source string, w io.Writer) int {
+	var candidates []string
+	if _, ok := alphabetProfiles[source]; ok {
+		candidates, _ = profileChars(source, loadChars())
+	} else {
+		candidates = loadCharsFile(source)
+	}
+	if err := engine.WriteAlphabetLintCSV(w, engine.LintChars(candidates)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing alphabet lint %v\n", err)
+		return 1
+	}
+	if err := engine.CheckAlphabet(candidates); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "All %d characters are safe\n", len(candidates))
+	return 0
+}
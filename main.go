@@ -1,15 +1,16 @@
 package main
 
 // TODO: convert to using a proper logging package
-// TODO: embed the unicode csv
 import (
-	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"git.doterra.net/salesforce/hierarchy-calculation-engine/bulkQuery"
@@ -23,27 +24,50 @@ import (
 
 const (
 	defaultPort         = "8080"
-	charFile            = "./assets/unicodechars.csv"
 	version             = "53.0"
 	retrieveRecordCount = 1000000
+	// updatePollInterval is how often the state of submitted bulk update jobs is checked
+	updatePollInterval = 10 * time.Second
 )
 
 var (
+	// Fields holding the materialized ancestry, only used when requested for the job
+	ancestryFields = []string{
+		"Parent_1_Ultimate_Parent__c",
+		"Parent_1_Ancestor_Path__c",
+		"Parent_2_Ultimate_Parent__c",
+		"Parent_2_Ancestor_Path__c",
+	}
 	chars        []string
 	invalidChars = []string{"%", "_", ",", "\"", "'", "\\", "*", "?"}
-	work         chan sessionovd.Session
+	work         chan job
+	budget       *memoryBudget
 )
 
 func main() {
+	lintPath := flag.String("lint-alphabet", "", "classify every character of an alphabet profile or CSV, write the report to "+
+		"stdout and exit with status 1 when any are risky")
+	flag.Parse()
+	if *lintPath != "" {
+		os.Exit(lintAlphabet(*lintPath, os.Stdout))
+	}
+
 	chars = loadChars()
-	fmt.Printf("Loaded %d characters\n", len(chars))
-	work = make(chan sessionovd.Session, 5)
-	go func() {
-		for {
-			session := <-work
-			calculateSalesforceLineageChains(&session)
-		}
-	}()
+	fmt.Printf("Loaded %d characters, alphabet %s\n", len(chars), engine.AlphabetFingerprint(chars))
+	if err := engine.CheckAlphabet(chars); err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+	work = make(chan job, 5)
+	budget = newMemoryBudget(envUint(memoryBudgetEnv, 0) * bytesPerMB)
+	workers := envUint(workersEnv, 1)
+	for i := uint64(0); i < workers; i++ {
+		go func() {
+			for {
+				j := <-work
+				calculateSalesforceLineageChains(&j.Session, j.Options)
+			}
+		}()
+	}
 	http.HandleFunc("/calculatehierarchy", handleCalculateRequest)
 	portNum := os.Getenv("PORT")
 	if len(portNum) == 0 {
@@ -63,30 +87,44 @@ func handleCalculateRequest(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
-	// Get session id and org url from payload
-	var s sessionovd.Session
-	err = json.Unmarshal(body, &s)
+	// Get session id, org url and job options from payload
+	var j job
+	err = json.Unmarshal(body, &j)
 	if err != nil {
 		panic(err)
 	}
-	s.TokenType = "Bearer"
-	s.Version = "v" + version
-	s.HTTPClient = &http.Client{}
+	// Reject bad options now rather than after the org has been loaded
+	if err := j.Options.validate(); err != nil {
+		msg, _ := json.Marshal(err.Error())
+		w.WriteHeader(400)
+		w.Write([]byte("{\"status\": 400, \"message\":" + string(msg) + "}"))
+		return
+	}
+	j.TokenType = "Bearer"
+	j.Version = "v" + version
+	j.HTTPClient = &http.Client{}
 	// Enqueue the work
 	// TODO: test the session before telling the caller that we're good to go
-	work <- s
+	work <- j
 	// send back a success message
 	w.WriteHeader(201)
 	w.Write([]byte("{\"status\": 201, \"message\":\"Org queued for processing\"}"))
 }
 
-func calculateSalesforceLineageChains(session *sessionovd.Session) {
+func calculateSalesforceLineageChains(session *sessionovd.Session, opts jobOptions) {
 	conn := bulkQuery.Connection{AccessToken: session.AccessToken,
 		InstanceUrl: session.InstanceURL(),
 		ApiVersion:  version,
 		Client:      *session.HTTPClient}
 
 	idLookupTable := make(map[string]uint32)
+	alphabet, err := opts.alphabet()
+	if err != nil {
+		fmt.Printf("Error choosing alphabet %v\n", err)
+		return
+	}
+	fingerprint := engine.AlphabetFingerprint(alphabet)
+	fmt.Printf("Building chains from alphabet %s with %d characters\n", fingerprint, len(alphabet))
 
 	// Need Id, match field, reference field, chain storage field, depth storage field
 	input := soql.QueryInput{
@@ -97,9 +135,28 @@ func calculateSalesforceLineageChains(session *sessionovd.Session) {
 			"Parent_1__c",
 			"Parent_2__c",
 			"Parent_1_Lineage_Chain__c",
+			"Parent_1_Lineage_Depth__c",
 			"Parent_2_Lineage_Chain__c",
+			"Parent_2_Lineage_Depth__c",
 		},
 	}
+	if opts.ChainContinuation {
+		for _, mode := range parentModes {
+			input.FieldList = append(input.FieldList, chainContinuationField(mode))
+		}
+	}
+	if opts.AlphabetField != "" {
+		input.FieldList = append(input.FieldList, opts.AlphabetField)
+	}
+	if opts.RollupValueField != "" {
+		input.FieldList = append(input.FieldList, opts.RollupValueField)
+	}
+	if opts.Ancestry {
+		input.FieldList = append(input.FieldList, ancestryFields...)
+	}
+	if opts.LevelAncestors > 0 {
+		input.FieldList = append(input.FieldList, levelAncestorFields(opts.LevelAncestors)...)
+	}
 	queryStmt, err := soql.NewQuery(input)
 	if err != nil {
 		fmt.Printf("SOQL Query Statement Error %s\n", err.Error())
@@ -127,13 +184,50 @@ func calculateSalesforceLineageChains(session *sessionovd.Session) {
 
 	engine.TimeTrack(beforeQueryTime, "Initial query and response")
 
+	// Hold off loading the org until its estimated memory fits the budget
+	decision, estimate, release := budget.admit(resp.NumberRecordsProcessed, &opts)
+	fmt.Printf("Estimated %d MB for %d records, admission %s\n", estimate/bytesPerMB, resp.NumberRecordsProcessed, decision)
+	if decision == admitRejected {
+		run := runResult{JobID: resp.ID, Records: int(resp.NumberRecordsProcessed), Admission: decision,
+			EstimatedMB: estimate / bytesPerMB}
+		if opts.AllowLowMemory {
+			if run.LowMemoryUnsupported = lowMemoryUnsupported(opts); len(run.LowMemoryUnsupported) > 0 {
+				run.Refused = fmt.Sprintf("the job doesn't fit the memory budget and the low memory strategy "+
+					"can't run %s", strings.Join(run.LowMemoryUnsupported, ", "))
+				fmt.Printf("Rejecting job, %s\n", run.Refused)
+			}
+		}
+		run.log()
+		return
+	}
+	defer release()
+
 	result, err := bulkQuery.RetrieveBulkQueryResults(resp.ID, conn, retrieveRecordCount, "")
+	if err != nil {
+		fmt.Printf("Error retrieving Bulk Query results: %s", err)
+		return
+	}
+	if opts.lowMemory {
+		// Stream the trees from disk instead of building every record in memory
+		run := runResult{JobID: resp.ID, Records: int(resp.NumberRecordsProcessed), Admission: decision,
+			EstimatedMB: estimate / bytesPerMB, Alphabet: fingerprint}
+		defer func() { run.log() }()
+		if err := calculateExternalTrees(session, result, opts, alphabet, &run); err != nil {
+			fmt.Printf("Error calculating with the low memory strategy %v\n", err)
+			return
+		}
+		if run.FailedUpdates > 0 || len(run.OversizeChains) > 0 {
+			return
+		}
+		saveAlphabetRecord(alphabetRecord{Fingerprint: fingerprint, Characters: len(alphabet), JobID: resp.ID,
+			Recorded: time.Now().UTC()}, session.InstanceURL())
+		return
+	}
 
 	totalSize := resp.NumberRecordsProcessed
 	fmt.Printf("Retrieving %d records from Salesforce\n", totalSize)
 	// process query results into container and pass to function that will drive the engine
-	g := &engine.Group{Members: make(map[uint32]engine.Record, totalSize)}
-	g.SetChars(chars)
+	members := make(map[uint32]engine.MultiRecord, totalSize)
 	// loop through results, querying for additional records as needed
 	digestingRecordsTime := time.Now()
 
@@ -149,12 +243,8 @@ func calculateSalesforceLineageChains(session *sessionovd.Session) {
 
 				// fmt.Printf("Record raw: %v\n", r)
 				dIDString := r[result.ColumnMap["Customer_Number__c"]]
-				parent1BranchID := r[result.ColumnMap["Parent_1_Lineage_Chain__c"]]
-				parent2BranchID := r[result.ColumnMap["Parent_2_Lineage_Chain__c"]]
 
-				dIDInt, err := strconv.Atoi(dIDString[:len(dIDString)-2])
-				// fmt.Printf("%v -- %v", dIDString, dIDInt)
-				dID := uint32(dIDInt)
+				dID, err := parseCustomerNumber(dIDString)
 				if err != nil {
 					// fmt.Printf("Error %v", err)
 					continue
@@ -165,20 +255,45 @@ func calculateSalesforceLineageChains(session *sessionovd.Session) {
 				p2ID := r[result.ColumnMap["Parent_2__c"]]
 				p1ID := r[result.ColumnMap["Parent_1__c"]]
 
-				rec := record{
-					id:              dID,
-					sfID:            sfID,
-					parent1SFID:     p1ID,
-					parent2SFID:     p2ID,
-					parent1BranchID: parent1BranchID,
-					parent2BranchID: parent2BranchID,
-					parentMode:      parent1,
-					idLookupTable:   &idLookupTable,
+				rec := newRecord(dID, sfID, &idLookupTable)
+				if opts.ChainContinuation {
+					rec.chainMaxLength = opts.chainMaxLength()
+				}
+				rec.chainCapacity = opts.chainCapacity()
+				rec.ancestry = opts.Ancestry
+				if opts.AlphabetField != "" {
+					rec.alphabetField = opts.AlphabetField
+					rec.loadedAlphabet = r[result.ColumnMap[opts.AlphabetField]]
+					rec.alphabet = fingerprint
+				}
+				if opts.RollupValueField != "" {
+					rec.value, _ = strconv.ParseFloat(r[result.ColumnMap[opts.RollupValueField]], 64)
+				}
+				rec.parent1Tree.parentSFID = p1ID
+				rec.parent2Tree.parentSFID = p2ID
+				for _, mode := range parentModes {
+					prefix := fieldPrefix(mode)
+					loaded := treeValues{
+						branchID:    r[result.ColumnMap[prefix+"_Lineage_Chain__c"]],
+						branchDepth: parseDepth(r[result.ColumnMap[prefix+"_Lineage_Depth__c"]]),
+					}
+					if opts.ChainContinuation {
+						loaded.branchID = engine.JoinChain(loaded.branchID, r[result.ColumnMap[chainContinuationField(mode)]])
+					}
+					if opts.Ancestry {
+						loaded.ultimateParent = r[result.ColumnMap[prefix+"_Ultimate_Parent__c"]]
+						loaded.ancestorPath = r[result.ColumnMap[prefix+"_Ancestor_Path__c"]]
+					}
+					if opts.LevelAncestors > 0 {
+						loaded.levelAncestorSFIDs = make([]string, opts.LevelAncestors)
+						for i := 1; i <= opts.LevelAncestors; i++ {
+							loaded.levelAncestorSFIDs[i-1] = r[result.ColumnMap[levelAncestorField(mode, i)]]
+						}
+					}
+					rec.tree(mode).load(loaded)
 				}
 				// fmt.Printf("Record:%v\n", rec)
-				rec.ChangeParentMode(parent1)
-				// fmt.Printf("Record: %v\n", rec)
-				g.Members[dID] = &rec
+				members[dID] = rec
 			}
 		}
 		fmt.Println("Finished all work and returning to synchronous processing")
@@ -214,77 +329,232 @@ func calculateSalesforceLineageChains(session *sessionovd.Session) {
 	// Wait for all async processing to complete by waiting for a message on this channel
 	fmt.Println("Waiting for results to finish processing")
 	<-resultsDoneChan
-	fmt.Printf("All data processed and ready to go with %d records\n", len(g.Members))
+	fmt.Printf("All data processed and ready to go with %d records\n", len(members))
 
 	engine.TimeTrack(digestingRecordsTime, "Digest records from API")
 	engine.PrintMemUsage()
-	// fmt.Printf("Members count %v", len(g.Members))
-	// Calculate the parent hierarchy
-	g.CalculateHierarchy()
-
-	updateSize := 0
-	for _, v := range g.Members {
-		if v.(*record).GetIsChanged() {
-			updateSize++
+	if opts.RestoreParents {
+		exportParentRestore(engine.NewHierarchyGroups(members, parentModes, alphabet), resp.ID)
+		return
+	}
+	dates, err := opts.asOfDates()
+	if err != nil {
+		fmt.Printf("Error reading as of dates %v\n", err)
+		return
+	}
+	if len(dates) > 0 {
+		histories, err := loadParentHistories(conn, members, idLookupTable, opts)
+		if err != nil {
+			fmt.Printf("Error loading parent history %v\n", err)
+			return
 		}
+		exportAsOfHierarchies(histories, dates, alphabet, resp.ID)
+		return
 	}
-
-	fmt.Printf("First tree generated %v record updates\n", updateSize)
-
-	// Swap values to the other side and run it again
-	beforeShuffleRecords := time.Now()
-	for _, v := range g.Members {
-		v.(*record).ChangeParentMode(parent2)
-		g.Members[v.GetID()] = v
+	// Refuse to rewrite chains stored with another alphabet unless the job confirms it
+	stored, err := storedAlphabets(session.InstanceURL(), members)
+	if err != nil {
+		fmt.Printf("Error reading stored alphabets %v\n", err)
+		return
+	}
+	if err := opts.checkAlphabetChange(fingerprint, stored); err != nil {
+		fmt.Printf("Refusing to update chains, %v\n", err)
+		runResult{JobID: resp.ID, Records: len(members), Admission: decision, EstimatedMB: estimate / bytesPerMB,
+			Alphabet: fingerprint, StoredAlphabets: stored, Refused: err.Error()}.log()
+		return
+	}
+	// Calculate the parent hierarchies
+	groups := engine.NewHierarchyGroups(members, parentModes, alphabet)
+	for _, g := range groups {
+		g.SetIDOrder(opts.SiblingIDOrder)
+	}
+	if opts.ValidateChains {
+		for _, mode := range parentModes {
+			exportChainValidation(groups[mode], resp.ID, mode)
+		}
+	}
+	if len(opts.TraceIDs) > 0 {
+		for _, g := range groups {
+			g.TraceBranchIDs(opts.TraceIDs...)
+		}
+	}
+	chains := projectChainLengths(groups, opts)
+	engine.CalculateGroups(groups)
+	for _, mode := range parentModes {
+		if len(opts.TraceIDs) > 0 {
+			exportBranchTraces(groups[mode], resp.ID, mode, opts.TraceIDs)
+		}
+		calculateTreeOutputs(groups[mode], resp.ID, mode, opts)
+		if opts.SaveSnapshots || opts.DiffPrevious {
+			snapshot := groups[mode].Snapshot()
+			if opts.DiffPrevious {
+				if previous := loadSnapshot(session.InstanceURL(), mode); previous != nil {
+					exportSnapshotDiff(previous, snapshot, resp.ID, mode)
+				} else {
+					fmt.Printf("No previous %s snapshot to compare against\n", mode)
+				}
+			}
+			if opts.SaveSnapshots {
+				saveSnapshot(snapshot, session.InstanceURL(), mode)
+			}
+		}
+	}
+	run := runResult{JobID: resp.ID, Records: len(members), Chains: chains, Admission: decision,
+		EstimatedMB: estimate / bytesPerMB, Alphabet: fingerprint, StoredAlphabets: stored,
+		AlphabetUnrecorded: warnUnrecordedAlphabet(stored, fingerprint)}
+	if opts.CompareHierarchies {
+		run.Comparison = exportHierarchyComparison(groups, resp.ID)
 	}
-	engine.TimeTrack(beforeShuffleRecords, "Shuffled Records to Sponsor")
-	// Calculate the Parent2 hierarchy
-	g.CalculateHierarchy()
 
-	updateSize = 0
-	for _, v := range g.Members {
-		if v.(*record).GetIsChanged() {
-			updateSize++
+	changes := make(map[uint32][]fieldChange)
+	for id, v := range members {
+		for mode := range v.(*record).oversizeTrees() {
+			if run.OversizeChains == nil {
+				run.OversizeChains = make(map[string]int)
+			}
+			run.OversizeChains[mode]++
+		}
+		if c := v.(*record).changes(); len(c) > 0 {
+			changes[id] = c
 		}
 	}
+	warnOversizeChains(run.OversizeChains, opts)
 
-	fmt.Printf("Both trees together generated %v record updates\n", updateSize)
+	fmt.Printf("Both trees together generated %v record updates\n", len(changes))
+	run.Updates = len(changes)
+	defer func() { run.log() }()
+	if opts.ExportChanges {
+		exportFieldChanges(members, changes, resp.ID)
+	}
 
 	// process changed records and submit back to Salesforce
-	err = updateRecords(session, &g.Members)
+	run.FailedUpdates, err = updateRecords(session, members, changes)
 	if err != nil {
 		fmt.Printf("Error updating records %v\n", err)
+		return
+	}
+	if run.FailedUpdates > 0 || len(run.OversizeChains) > 0 {
+		// The rows that failed and the trees left out keep the chains of the alphabet they were stored with
+		return
 	}
+	saveAlphabetRecord(alphabetRecord{Fingerprint: fingerprint, Characters: len(alphabet), JobID: resp.ID,
+		Recorded: time.Now().UTC()}, session.InstanceURL())
 }
 
-func updateRecords(session session.ServiceFormatter, data *map[uint32]engine.Record) error {
-	// determine how many records need to be updated
-	updateSize := 0
-	for _, v := range *data {
-		if v.(*record).GetIsChanged() {
-			updateSize++
+// warnOversizeChains reports the trees left out of the update because their chains don't fit the chain fields
+func warnOversizeChains(oversize map[string]int, opts jobOptions) {
+	for _, mode := range parentModes {
+		if n := oversize[mode]; n > 0 {
+			fmt.Printf("WARNING: %d %s lineage chains are longer than the %d characters available, those trees "+
+				"were left out of the update\n", n, mode, opts.chainCapacity())
 		}
 	}
-	if updateSize == 0 {
+}
+
+// projectChainLengths reports the longest lineage chain each tree needs, warning when it won't fit the chain fields
+func projectChainLengths(groups map[string]*engine.Group, opts jobOptions) map[string]engine.ChainProjection {
+	chains := make(map[string]engine.ChainProjection, len(groups))
+	for _, mode := range parentModes {
+		p := groups[mode].ProjectChainLength()
+		chains[mode] = p
+		fmt.Printf("Longest %s lineage chain is projected at %d characters for %d at depth %d\n", mode, p.MaxLength,
+			p.ID, p.Depth)
+		if p.MaxLength > opts.chainCapacity() {
+			fmt.Printf("WARNING: %s lineage chains up to %d characters don't fit the %d available, "+
+				"those trees will be left out of the update\n", mode, p.MaxLength, opts.chainCapacity())
+		}
+	}
+	return chains
+}
+
+// calculateTreeOutputs calculates the optional outputs requested for the job from a calculated hierarchy
+func calculateTreeOutputs(g *engine.Group, jobID string, mode parentMode, opts jobOptions) {
+	if opts.GenerationLevels > 0 {
+		g.CalculateGenerationCounts(opts.GenerationLevels)
+		exportGenerationCounts(g, jobID, mode, opts.GenerationLevels)
+	}
+	if opts.RollupValueField != "" {
+		g.CalculateRollups(opts.RollupLevels)
+		exportRollups(g, jobID, mode)
+	}
+	if opts.ClosureTable {
+		exportClosure(g, jobID, mode, opts.ClosureMaxDistance)
+	}
+	if opts.Ancestry {
+		g.CalculateAncestry()
+		truncated := 0
+		for _, v := range g.Members {
+			if v.(*treeRecord).setAncestry(g.Members, opts.AncestorPathSFIDs) {
+				truncated++
+			}
+		}
+		if truncated > 0 {
+			fmt.Printf("WARNING: %d %s ancestor paths are longer than %d characters, their top-most ancestors were "+
+				"replaced with %s\n", truncated, mode, ancestorPathMaxLength, engine.AncestorPathTruncated)
+		}
+	}
+	if opts.LevelAncestors > 0 {
+		order := engine.LevelsFromRoot
+		if opts.LevelAncestorsFromRecord {
+			order = engine.LevelsFromRecord
+		}
+		g.CalculateLevelAncestors(opts.LevelAncestors, order)
+		for _, v := range g.Members {
+			v.(*treeRecord).setLevelAncestors(g.Members, opts.LevelAncestors)
+		}
+	}
+}
+
+// updateRecords submits the changed records and returns the number of rows Salesforce failed to update
+func updateRecords(session session.ServiceFormatter, data map[uint32]engine.MultiRecord,
+	changes map[uint32][]fieldChange) (int, error) {
+	if len(changes) == 0 {
 		fmt.Printf("No updates needed to data\n")
-		return nil
-	}
-	fmt.Printf("Processing updates to %v records\n", updateSize)
-	// TODO: break into chunks and submit as separate jobs
-	recordsToUpdate := make([]bulk.Record, 0, updateSize)
-	for _, v := range *data {
-		if v.(*record).GetIsChanged() {
-			recordsToUpdate = append(recordsToUpdate, v.(*record))
+		return 0, nil
+	}
+	fmt.Printf("Processing updates to %v records\n", len(changes))
+	fieldSets, recordsByFields := bucketUpdates(data, changes)
+	return submitUpdates(session, fieldSets, recordsByFields)
+}
+
+// bucketUpdates groups the changed records into bulk jobs by the column groups they changed, every field of a tree
+// with a changed value plus the alphabet field when it changed, so the number of bulk jobs stays bounded by the
+// handful of group combinations. Records only fill in the fields that changed, see record.Fields.
+func bucketUpdates(data map[uint32]engine.MultiRecord, changes map[uint32][]fieldChange) (map[string][]string,
+	map[string][]bulk.Record) {
+	fieldSets := make(map[string][]string)
+	recordsByFields := make(map[string][]bulk.Record)
+	for id, c := range changes {
+		r := data[id].(*record)
+		changed := make(map[string]bool)
+		for _, fc := range c {
+			changed[fc.group] = true
 		}
+		fields := []string{"Id"}
+		var groups []string
+		for _, group := range columnGroups {
+			if changed[group] {
+				groups = append(groups, group)
+				fields = append(fields, r.columnFields(group)...)
+			}
+		}
+		key := strings.Join(groups, ",")
+		fieldSets[key] = fields
+		recordsByFields[key] = append(recordsByFields[key], r)
 	}
+	return fieldSets, recordsByFields
+}
 
-	fields := []string{
-		"Id",
-		"Parent_1_Lineage_Chain__c",
-		"Parent_1_Lineage_Depth__c",
-		"Parent_2_Lineage_Chain__c",
-		"Parent_2_Lineage_Depth__c",
+// submitUpdates sends each bucket of records as bulk update jobs with the bucket's fields, in bucket key order, and
+// waits for Salesforce to process them, returning the number of rows that failed
+func submitUpdates(session session.ServiceFormatter, fieldSets map[string][]string,
+	recordsByFields map[string][]bulk.Record) (int, error) {
+	keys := make([]string, 0, len(fieldSets))
+	for key := range fieldSets {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+
 	jobOpts := bulk.Options{
 		ColumnDelimiter: bulk.Comma,
 		Operation:       bulk.Update,
@@ -292,44 +562,46 @@ func updateRecords(session session.ServiceFormatter, data *map[uint32]engine.Rec
 	}
 
 	beforeProcessDataAsBulk := time.Now()
-	jobs, err := bulk.ProcessDataAsBulkJobs(session, jobOpts, fields, recordsToUpdate)
-	if err != nil {
-		return err
+	var jobs []*bulk.Job
+	for _, key := range keys {
+		if len(recordsByFields[key]) == 0 {
+			continue
+		}
+		keyJobs, err := bulk.ProcessDataAsBulkJobs(session, jobOpts, fieldSets[key], recordsByFields[key])
+		jobs = append(jobs, keyJobs...)
+		if err != nil {
+			return 0, err
+		}
 	}
 	fmt.Printf("Completed sending data in %d jobs\n", len(jobs))
 	engine.TimeTrack(beforeProcessDataAsBulk, "Process records and start bulk job(s)")
-	return nil
+	return waitForUpdateJobs(jobs)
 }
 
-// Load characters from CSV to behave like a multi-thousand based number system
-func loadChars() []string {
-	var mChars = make([]string, 0)
-	// Open CSV file
-	f, err := os.Open(charFile)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	// Read File into a Variable
-	lines, err := csv.NewReader(f).ReadAll()
-	if err != nil {
-		panic(err)
-	}
-	// Drop the header line
-	lines = lines[1:]
-	// Loop through lines & turn into object
-
-	invalidCharMap := make(map[string]bool)
-	for _, c := range invalidChars {
-		invalidCharMap[c] = true
-	}
-	for _, line := range lines {
-		if _, invalid := invalidCharMap[line[0]]; invalid {
-			// Skip the char because we've outlawed it
-			continue
+// waitForUpdateJobs waits for Salesforce to finish the bulk update jobs and returns the number of rows that failed.
+// A failed or aborted job is an error as its rows weren't all processed.
+func waitForUpdateJobs(jobs []*bulk.Job) (int, error) {
+	failed := 0
+	for _, j := range jobs {
+		for {
+			info, err := j.Info()
+			if err != nil {
+				return failed, err
+			}
+			state := bulk.State(info.State)
+			if state == bulk.Failed || state == bulk.Aborted {
+				return failed + info.NumberRecordsFailed, fmt.Errorf("bulk job %s %s: %s", info.ID, info.State,
+					info.ErrorMessage)
+			}
+			if state == bulk.JobComplete {
+				failed += info.NumberRecordsFailed
+				break
+			}
+			time.Sleep(updatePollInterval)
 		}
-		mChars = append(mChars, line[0])
 	}
-	return mChars
+	if failed > 0 {
+		fmt.Printf("WARNING: Salesforce failed to update %d rows\n", failed)
+	}
+	return failed, nil
 }
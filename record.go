@@ -1,98 +1,354 @@
 package main
 
-import "git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
 
 type parentMode = string
 
 const (
+	ancestorPathSeparator = "/"
+	// ancestorPathMaxLength is the length of the ancestor path text field
+	ancestorPathMaxLength = 255
+
 	parent1 parentMode = "parent1"
 	parent2 parentMode = "parent2"
 )
 
+// parentModes are the hierarchies calculated for every record
+var parentModes = []parentMode{parent1, parent2}
+
 type record struct {
-	id                 uint32
-	children           []uint32
-	isChanged          bool
-	parentMode         parentMode
-	sfID               string
-	parent1SFID        string
-	parent2SFID        string
-	parent1BranchID    string
-	parent2BranchID    string
-	parent1BranchDepth uint8
-	parent2BranchDepth uint8
-	idLookupTable      *map[string]uint32
-}
-
-func (r *record) ChangeParentMode(parentMode string) {
-	r.parentMode = parentMode
-	r.children = []uint32{}
+	id            uint32
+	sfID          string
+	parent1Tree   treeRecord
+	parent2Tree   treeRecord
+	idLookupTable *map[string]uint32
+	// value is the number rolled up over the downline of both trees
+	value float64
+	// chainMaxLength splits lineage chains longer than it into the continuation field, 0 keeps a single field
+	chainMaxLength int
+	// chainCapacity is the longest lineage chain the chain fields hold, trees with longer chains aren't updated
+	chainCapacity int
+	// ancestry writes the ultimate parent and ancestor path fields of both trees
+	ancestry bool
+	// alphabetField holds the fingerprint of the alphabet the chains were built from, empty when not written
+	alphabetField  string
+	alphabet       string
+	loadedAlphabet string
+}
+
+// treeRecord is a record's place in a single parent hierarchy, surfaced to the engine as its own engine.Record
+type treeRecord struct {
+	treeValues
+	loaded         treeValues
+	record         *record
+	parentSFID     string
+	children       []uint32
+	generations    []uint32
+	rollup         engine.Rollup
+	rootID         uint32
+	ancestors      []uint32
+	levelAncestors []uint32
+}
+
+// treeValues are the Salesforce field values of a record in a single parent hierarchy
+type treeValues struct {
+	branchID           string
+	branchDepth        uint8
+	ultimateParent     string
+	ancestorPath       string
+	levelAncestorSFIDs []string
+}
+
+// fieldValue is a single Salesforce field and its value
+type fieldValue struct {
+	field string
+	value interface{}
 }
+
+// fieldChange is a field whose calculated value differs from the value loaded from Salesforce, group is the column
+// group the field is updated with
+type fieldChange struct {
+	field    string
+	group    string
+	oldValue interface{}
+	newValue interface{}
+}
+
+// alphabetColumns is the column group of the alphabet field, the fields of each tree are grouped by parent mode
+const alphabetColumns = "alphabet"
+
+// columnGroups are the groups of fields updated together, in the order they're sent
+var columnGroups = []string{parent1, parent2, alphabetColumns}
+
+func newRecord(id uint32, sfID string, idLookupTable *map[string]uint32) *record {
+	r := &record{id: id, sfID: sfID, idLookupTable: idLookupTable}
+	r.parent1Tree = treeRecord{record: r, rootID: engine.Uint32Max}
+	r.parent2Tree = treeRecord{record: r, rootID: engine.Uint32Max}
+	return r
+}
+
 func (r *record) GetID() uint32 {
 	return r.id
 }
-func (r *record) GetParentID() uint32 {
-	parent := ""
-	switch r.parentMode {
-	case parent1:
-		parent = r.parent1SFID
-	case parent2:
-		parent = r.parent2SFID
+
+// GetHierarchy returns the view of the record in the named parent hierarchy
+func (r *record) GetHierarchy(name string) engine.Record {
+	return r.tree(name)
+}
+func (r *record) tree(mode parentMode) *treeRecord {
+	if mode == parent2 {
+		return &r.parent2Tree
+	}
+	return &r.parent1Tree
+}
+
+// oversizeTrees are the parent modes whose calculated lineage chain is longer than the chain fields hold
+func (r *record) oversizeTrees() map[parentMode]bool {
+	oversize := make(map[parentMode]bool)
+	for _, mode := range parentModes {
+		if utf8.RuneCountInString(r.tree(mode).branchID) > r.chainCapacity {
+			oversize[mode] = true
+		}
+	}
+	return oversize
+}
+
+// changes lists every field of both trees whose calculated value differs from the loaded value, followed by the
+// alphabet field when the chains are now built from a different alphabet. Trees whose chain doesn't fit the chain
+// fields are left out, and so is the alphabet field as their stored chain keeps its alphabet.
+func (r *record) changes() []fieldChange {
+	var changes []fieldChange
+	oversize := r.oversizeTrees()
+	for _, mode := range parentModes {
+		if oversize[mode] {
+			continue
+		}
+		t := r.tree(mode)
+		changes = append(changes, treeChanges(mode, t.loaded, t.treeValues, r.chainMaxLength, r.ancestry)...)
+	}
+	if r.alphabetField != "" && r.alphabet != r.loadedAlphabet && len(oversize) == 0 {
+		changes = append(changes, fieldChange{field: r.alphabetField, group: alphabetColumns, oldValue: r.loadedAlphabet,
+			newValue: r.alphabet})
+	}
+	return changes
+}
+
+// treeChanges lists the fields of a tree whose current value differs from the loaded value
+func treeChanges(mode parentMode, loaded, current treeValues, chainMaxLength int, ancestry bool) []fieldChange {
+	var changes []fieldChange
+	old := loaded.fieldValues(mode, chainMaxLength, ancestry)
+	for i, v := range current.fieldValues(mode, chainMaxLength, ancestry) {
+		var oldValue interface{}
+		if i < len(old) {
+			oldValue = old[i].value
+		}
+		if oldValue != v.value {
+			changes = append(changes, fieldChange{field: v.field, group: mode, oldValue: oldValue, newValue: v.value})
+		}
+	}
+	return changes
+}
+
+// bulkValue is the value a changed field is sent with, an emptied field is cleared rather than left blank
+func bulkValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return bulkNull
+	}
+	return value
+}
+
+// columnFields lists the fields of a column group, every field of the tree for a parent mode
+func (r *record) columnFields(group string) []string {
+	if group == alphabetColumns {
+		return []string{r.alphabetField}
+	}
+	values := r.tree(group).fieldValues(group, r.chainMaxLength, r.ancestry)
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = v.field
+	}
+	return fields
+}
+
+// load sets the values read from Salesforce as both the loaded and current values
+func (t *treeRecord) load(values treeValues) {
+	t.treeValues = values
+	t.loaded = values
+}
+
+// parseDepth reads a stored lineage depth, Salesforce returns number fields with decimals and blanks for no value
+func parseDepth(value string) uint8 {
+	depth, err := strconv.ParseFloat(value, 64)
+	if err != nil || depth < 0 || depth > 255 {
+		return 0
+	}
+	return uint8(depth)
+}
+
+// fieldValues lists the values by Salesforce field in a stable order, splitting the lineage chain over the primary
+// and continuation fields when a max length is given. The ancestry fields are only listed when they're written.
+func (v treeValues) fieldValues(mode parentMode, chainMaxLength int, ancestry bool) []fieldValue {
+	prefix := fieldPrefix(mode)
+	values := []fieldValue{{prefix + "_Lineage_Chain__c", v.branchID}}
+	if chainMaxLength > 0 {
+		parts := engine.SplitChain(v.branchID, chainMaxLength)
+		values = []fieldValue{
+			{prefix + "_Lineage_Chain__c", parts[0]},
+			{chainContinuationField(mode), engine.JoinChain(parts[1:]...)},
+		}
+	}
+	values = append(values, fieldValue{prefix + "_Lineage_Depth__c", v.branchDepth})
+	if ancestry {
+		values = append(values, []fieldValue{
+			{prefix + "_Ultimate_Parent__c", v.ultimateParent},
+			{prefix + "_Ancestor_Path__c", v.ancestorPath},
+		}...)
+	}
+	for i, sfID := range v.levelAncestorSFIDs {
+		values = append(values, fieldValue{levelAncestorField(mode, i+1), sfID})
 	}
+	return values
+}
+
+func (t *treeRecord) GetID() uint32 {
+	return t.record.id
+}
+func (t *treeRecord) GetParentID() uint32 {
 	parentID := engine.Uint32Max
-	if parentIDVal, has := (*r.idLookupTable)[parent]; has {
+	if parentIDVal, has := (*t.record.idLookupTable)[t.parentSFID]; has {
 		parentID = parentIDVal
 	}
 	return parentID
 }
-func (r *record) GetChildren() []uint32 {
-	return r.children
+func (t *treeRecord) GetChildren() []uint32 {
+	return t.children
 }
-func (r *record) SetChildren(children []uint32) {
-	r.children = children
+func (t *treeRecord) SetChildren(children []uint32) {
+	t.children = children
 }
-func (r *record) GetBranchID() string {
-	switch r.parentMode {
-	case parent1:
-		return r.parent1BranchID
-	case parent2:
-		return r.parent2BranchID
+func (t *treeRecord) GetBranchID() string {
+	return t.branchID
+}
+func (t *treeRecord) SetBranchID(branchID string) {
+	t.branchID = branchID
+}
+func (t *treeRecord) SetBranchDepth(branchDepth uint8) {
+	t.branchDepth = branchDepth
+}
+func (t *treeRecord) GetGenerationCounts() []uint32 {
+	return t.generations
+}
+func (t *treeRecord) SetGenerationCounts(counts []uint32) {
+	t.generations = counts
+}
+func (t *treeRecord) GetValue() float64 {
+	return t.record.value
+}
+func (t *treeRecord) GetRollup() engine.Rollup {
+	return t.rollup
+}
+func (t *treeRecord) SetRollup(rollup engine.Rollup) {
+	t.rollup = rollup
+}
+func (t *treeRecord) SetRootID(rootID uint32) {
+	t.rootID = rootID
+}
+func (t *treeRecord) SetAncestors(ancestors []uint32) {
+	t.ancestors = ancestors
+}
+
+// sfIDOf maps a record ID back to its Salesforce ID
+func sfIDOf(members map[uint32]engine.Record, id uint32) string {
+	if m, ok := members[id]; ok {
+		return m.(*treeRecord).record.sfID
 	}
 	return ""
 }
-func (r *record) SetBranchID(branchID string) {
-	r.isChanged = true
-	switch r.parentMode {
-	case parent1:
-		r.parent1BranchID = branchID
-	case parent2:
-		r.parent2BranchID = branchID
+
+// setAncestry formats the engine's ancestry output into the tree's fields, reporting whether the ancestor path had to
+// drop its top-most ancestors to fit the field
+func (t *treeRecord) setAncestry(members map[uint32]engine.Record, pathSFIDs bool) bool {
+	ultimateParent := sfIDOf(members, t.rootID)
+	path := make([]string, len(t.ancestors))
+	for i, id := range t.ancestors {
+		if pathSFIDs {
+			path[i] = sfIDOf(members, id)
+		} else {
+			path[i] = strconv.FormatUint(uint64(id), 10)
+		}
 	}
+	ancestorPath, truncated := engine.JoinAncestorPath(path, ancestorPathSeparator, ancestorPathMaxLength)
+	// The list is only needed to build the path, release it
+	t.ancestors = nil
+	t.ultimateParent = ultimateParent
+	t.ancestorPath = ancestorPath
+	return truncated
 }
-func (r *record) SetBranchDepth(branchDepth uint8) {
-	switch r.parentMode {
-	case parent1:
-		r.parent1BranchDepth = branchDepth
+func (t *treeRecord) SetLevelAncestors(levelAncestors []uint32) {
+	t.levelAncestors = levelAncestors
+}
+
+// setLevelAncestors maps the engine's level ancestors to Salesforce IDs, blanking unused levels
+func (t *treeRecord) setLevelAncestors(members map[uint32]engine.Record, levels int) {
+	values := make([]string, levels)
+	for i, id := range t.levelAncestors {
+		values[i] = sfIDOf(members, id)
+	}
+	t.levelAncestors = nil
+	t.levelAncestorSFIDs = values
+}
+
+// Fields used to export data for SFDC Bulk API, used by package. Only the changed fields are listed, the other
+// columns of the record's bulk job are left blank which the update leaves alone.
+func (r record) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"Id": r.sfID,
+	}
+	for _, c := range r.changes() {
+		fields[c.field] = bulkValue(c.newValue)
+	}
+	return fields
+}
+
+// fieldPrefix is the prefix shared by the Salesforce fields of a parent mode
+func fieldPrefix(mode parentMode) string {
+	switch mode {
 	case parent2:
-		r.parent2BranchDepth = branchDepth
+		return "Parent_2"
 	}
+	return "Parent_1"
 }
-func (r *record) GetIsChanged() bool {
-	return r.isChanged
+
+// chainContinuationField is the Salesforce field holding the part of a parent mode's lineage chain that doesn't fit
+// the primary field
+func chainContinuationField(mode parentMode) string {
+	return fieldPrefix(mode) + "_Lineage_Chain_2__c"
 }
 
-// Fields used to export data for SFDC Bulk API, used by package
-func (r record) Fields() map[string]interface{} {
-	return map[string]interface{}{
-		"Id":                        r.sfID,
-		"Parent_1_Lineage_Chain__c": r.parent1BranchID,
-		"Parent_1_Lineage_Depth__c": r.parent1BranchDepth,
-		"Parent_2_Lineage_Chain__c": r.parent2BranchID,
-		"Parent_2_Lineage_Depth__c": r.parent2BranchDepth,
+// levelAncestorField is the Salesforce field holding the ancestor at the given level of a parent mode
+func levelAncestorField(mode parentMode, level int) string {
+	return fmt.Sprintf("%s_Level_%d_Ancestor__c", fieldPrefix(mode), level)
+}
+
+// levelAncestorFields lists the Level_1 to Level_N ancestor fields of both parent modes
+func levelAncestorFields(levels int) []string {
+	fields := make([]string, 0, levels*2)
+	for _, mode := range parentModes {
+		for i := 1; i <= levels; i++ {
+			fields = append(fields, levelAncestorField(mode, i))
+		}
 	}
+	return fields
 }
 
-// InsertNull used to submit values in nullable mode, used by package
+// InsertNull used to submit values in nullable mode, used by package. Unlisted fields must stay blank, cleared
+// fields are listed as bulkNull instead.
 func (r record) InsertNull() bool {
-	return true
+	return false
 }
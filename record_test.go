@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+// testRecord builds a record loaded with the values of both trees, chains fit 8 characters unless changed
+func testRecord(loaded1, loaded2 treeValues) *record {
+	r := newRecord(1, "sf1", &map[string]uint32{})
+	r.chainCapacity = 8
+	r.parent1Tree.load(loaded1)
+	r.parent2Tree.load(loaded2)
+	return r
+}
+
+func TestParseDepth(t *testing.T) {
+	for value, expected := range map[string]uint8{
+		"":      0,
+		"3":     3,
+		"3.0":   3,
+		"255":   255,
+		"256":   0,
+		"-1":    0,
+		"depth": 0,
+	} {
+		if depth := parseDepth(value); depth != expected {
+			t.Errorf("Expected %q to parse as %d, instead held %d", value, expected, depth)
+		}
+	}
+}
+
+func TestRecordChanges(t *testing.T) {
+	loaded := treeValues{branchID: "ab", branchDepth: 2, ultimateParent: "sf0", ancestorPath: "0"}
+	tests := []struct {
+		name     string
+		setup    func(r *record)
+		expected []string
+	}{
+		{"unchanged", func(r *record) {}, nil},
+		{"depth only", func(r *record) {
+			r.parent1Tree.branchDepth = 3
+		}, []string{"Parent_1_Lineage_Depth__c"}},
+		{"chain only", func(r *record) {
+			r.parent2Tree.branchID = "ac"
+		}, []string{"Parent_2_Lineage_Chain__c"}},
+		{"ancestry not written", func(r *record) {
+			r.parent1Tree.ancestorPath = "0/1"
+		}, nil},
+		{"ancestry written", func(r *record) {
+			r.ancestry = true
+			r.parent1Tree.ancestorPath = "0/1"
+		}, []string{"Parent_1_Ancestor_Path__c"}},
+		{"continuation", func(r *record) {
+			r.chainMaxLength = 2
+			r.parent1Tree.branchID = "abc"
+		}, []string{"Parent_1_Lineage_Chain_2__c"}},
+		{"alphabet", func(r *record) {
+			r.alphabetField = "Alphabet__c"
+			r.alphabet = "new"
+			r.loadedAlphabet = "old"
+		}, []string{"Alphabet__c"}},
+		{"oversize chain", func(r *record) {
+			r.alphabetField = "Alphabet__c"
+			r.alphabet = "new"
+			r.parent1Tree.branchID = "abcdefghi"
+			r.parent2Tree.branchDepth = 3
+		}, []string{"Parent_2_Lineage_Depth__c"}},
+	}
+	for _, test := range tests {
+		r := testRecord(loaded, loaded)
+		test.setup(r)
+		var fields []string
+		for _, c := range r.changes() {
+			fields = append(fields, c.field)
+		}
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("%s: expected changes to %v, instead held %v", test.name, test.expected, fields)
+		}
+	}
+}
+
+func TestRecordFields(t *testing.T) {
+	r := testRecord(treeValues{branchID: "abc", branchDepth: 2}, treeValues{branchID: "ab", branchDepth: 2})
+	r.chainMaxLength = 2
+	r.parent1Tree.branchID = "ab"
+	r.parent1Tree.branchDepth = 3
+	expected := map[string]interface{}{
+		"Id":                          "sf1",
+		"Parent_1_Lineage_Chain_2__c": bulkNull,
+		"Parent_1_Lineage_Depth__c":   uint8(3),
+	}
+	if fields := r.Fields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, instead held %v", expected, fields)
+	}
+	if r.InsertNull() {
+		t.Errorf("Expected unchanged fields to be left blank")
+	}
+}
+
+func TestBucketUpdates(t *testing.T) {
+	loaded := treeValues{branchID: "ab", branchDepth: 2}
+	records := []func(r *record){
+		func(r *record) { r.parent1Tree.branchDepth = 3 },
+		func(r *record) { r.parent1Tree.branchID = "ac" },
+		func(r *record) { r.parent2Tree.branchID = "ac" },
+		func(r *record) {
+			r.parent1Tree.branchID = "ac"
+			r.parent2Tree.branchID = "ac"
+		},
+		func(r *record) {
+			r.alphabetField = "Alphabet__c"
+			r.alphabet = "new"
+		},
+	}
+	data := make(map[uint32]engine.MultiRecord)
+	changes := make(map[uint32][]fieldChange)
+	for i, setup := range records {
+		r := testRecord(loaded, loaded)
+		r.id = uint32(i)
+		setup(r)
+		data[r.id] = r
+		changes[r.id] = r.changes()
+	}
+	fieldSets, recordsByFields := bucketUpdates(data, changes)
+	expected := map[string]string{
+		"parent1":         "Id,Parent_1_Lineage_Chain__c,Parent_1_Lineage_Depth__c",
+		"parent2":         "Id,Parent_2_Lineage_Chain__c,Parent_2_Lineage_Depth__c",
+		"parent1,parent2": "Id,Parent_1_Lineage_Chain__c,Parent_1_Lineage_Depth__c,Parent_2_Lineage_Chain__c,Parent_2_Lineage_Depth__c",
+		"alphabet":        "Id,Alphabet__c",
+	}
+	for key, fields := range expected {
+		if strings.Join(fieldSets[key], ",") != fields {
+			t.Errorf("Expected bucket %s to send %s, instead held %v", key, fields, fieldSets[key])
+		}
+	}
+	if len(fieldSets) != len(expected) {
+		t.Errorf("Expected %d buckets, instead held %v", len(expected), fieldSets)
+	}
+	if n := len(recordsByFields["parent1"]); n != 2 {
+		t.Errorf("Expected the depth and chain changes to share a bucket, instead held %d records", n)
+	}
+}
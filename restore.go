@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"git.doterra.net/salesforce/hierarchy-calculation-engine/engine"
+)
+
+// bulkNull is the Bulk API CSV value that clears a field, blank values are left alone on update
+const bulkNull = "#N/A"
+
+// exportParentRestore rebuilds Parent_1__c and Parent_2__c from the stored lineage chains and writes them as a
+// restore CSV for review and loading. Records whose parent can't be recovered get a blank value, which a Bulk API
+// update leaves as it is, and carry the reason in the status columns.
+func exportParentRestore(groups map[string]*engine.Group, jobID string) {
+	restored := make(map[parentMode][]engine.RestoredParent)
+	for _, mode := range parentModes {
+		restored[mode] = groups[mode].RestoreParents()
+	}
+
+	exportCSV(jobID, "parent-restore", func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		err := cw.Write([]string{"Id", "Parent_1__c", "Parent_2__c", "Parent_1_Restore_Status", "Parent_2_Restore_Status"})
+		if err != nil {
+			return err
+		}
+		summary := make(map[engine.RestoreStatus]int)
+		for i, p1 := range restored[parent1] {
+			p2 := restored[parent2][i]
+			r := groups[parent1].Members[p1.ID].(*treeRecord).record
+			summary[p1.Status]++
+			summary[p2.Status]++
+			err := cw.Write([]string{
+				r.sfID,
+				restoredParentSFID(groups[parent1], p1),
+				restoredParentSFID(groups[parent2], p2),
+				string(p1.Status),
+				string(p2.Status),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		fmt.Printf("Parent restore results %v\n", summary)
+		return cw.Error()
+	})
+}
+
+// restoredParentSFID maps a restored parent back to its Salesforce ID. Roots clear the field and parents that
+// couldn't be recovered are left blank, the current value may be the damaged one.
+func restoredParentSFID(g *engine.Group, rp engine.RestoredParent) string {
+	switch rp.Status {
+	case engine.RestoreResolved:
+		return sfIDOf(g.Members, rp.ParentID)
+	case engine.RestoreRoot:
+		return bulkNull
+	}
+	return ""
+}